@@ -0,0 +1,184 @@
+package conqueress
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// ErrInjectedFailure is the error a processor attempt fails with when chaos
+// mode fails it.
+var ErrInjectedFailure = errors.New("failure injected by chaos mode")
+
+const defaultOutOfOrderDelay = 100 * time.Millisecond
+
+// Distribution draws a delay from r.
+type Distribution func(r *rand.Rand) time.Duration
+
+// UniformDelay draws delays evenly between from and to.
+func UniformDelay(from, to time.Duration) Distribution {
+	return func(r *rand.Rand) time.Duration {
+		if to <= from {
+			return from
+		}
+		return from + time.Duration(r.Int64N(int64(to-from)+1))
+	}
+}
+
+// ExponentialDelay draws delays from an exponential distribution with the
+// given mean, so most are short and a few are long, capped at limit.
+func ExponentialDelay(mean, limit time.Duration) Distribution {
+	return func(r *rand.Rand) time.Duration {
+		return min(time.Duration(r.ExpFloat64()*float64(mean)), limit)
+	}
+}
+
+// ChaosConfig makes the mediator misbehave in the ways a distributed system
+// does, to flush out code that assumes read models are up to date or events
+// arrive once and in order. Every decision is drawn from a generator seeded
+// with Seed, on the goroutine that dispatches or publishes, so a test that
+// dispatches and publishes in the same order makes the same decisions for
+// the same seed.
+//
+// The rates are probabilities between 0 and 1. Delays that are nil are zero.
+type ChaosConfig struct {
+	// Seed seeds the generator. Zero picks a random seed. Either way the
+	// seed is logged when the mediator is created, and returned by
+	// Mediator.ChaosSeed, so a failing run can be repeated.
+	Seed uint64
+
+	// CommandDelay is how long each command waits before its handler runs.
+	CommandDelay Distribution
+	// EventDelay is how long each event waits before each processor
+	// receives it.
+	EventDelay Distribution
+
+	// ProcessorFailureRate is the chance that an attempt to deliver an event
+	// to a processor fails with ErrInjectedFailure instead of running it. The
+	// processor's retry policy applies as usual.
+	ProcessorFailureRate float64
+	// DuplicateDeliveryRate is the chance that a processor receives an event
+	// a second time after the first delivery.
+	DuplicateDeliveryRate float64
+	// OutOfOrderRate is the chance that an event published with Publish is
+	// held back for an extra OutOfOrderDelay, which defaults to 100ms, so
+	// events published after it usually overtake it. PublishSync delivers in
+	// order regardless.
+	OutOfOrderRate  float64
+	OutOfOrderDelay Distribution
+}
+
+// InducedDelayChaos is the chaos NewMediator(true) applies: commands wait up
+// to two seconds and events up to nine.
+func InducedDelayChaos() ChaosConfig {
+	return ChaosConfig{
+		CommandDelay: UniformDelay(0, 2*time.Second),
+		EventDelay:   UniformDelay(0, 9*time.Second),
+	}
+}
+
+// WithChaos turns on chaos mode with the given configuration.
+func WithChaos(config ChaosConfig) MediatorOption {
+	return func(m *Mediator) {
+		m.chaos = newChaos(config)
+	}
+}
+
+// ChaosSeed returns the seed chaos mode is using, or zero if it is off.
+func (m *Mediator) ChaosSeed() uint64 {
+	if m.chaos == nil {
+		return 0
+	}
+	return m.chaos.seed
+}
+
+type chaos struct {
+	config ChaosConfig
+	seed   uint64
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func newChaos(config ChaosConfig) *chaos {
+	seed := config.Seed
+	for seed == 0 {
+		seed = rand.Uint64()
+	}
+	if config.OutOfOrderDelay == nil {
+		config.OutOfOrderDelay = UniformDelay(defaultOutOfOrderDelay, defaultOutOfOrderDelay)
+	}
+
+	slog.With(
+		"seed", seed,
+	).Warn("Chaos mode is on")
+
+	return &chaos{
+		config: config,
+		seed:   seed,
+		rand:   rand.New(rand.NewPCG(seed, seed)),
+	}
+}
+
+// eventChaos is what chaos mode does to one delivery of an event to a
+// processor.
+type eventChaos struct {
+	delay     time.Duration
+	failures  int
+	duplicate bool
+}
+
+func (c *chaos) commandDelay() time.Duration {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.draw(c.config.CommandDelay)
+}
+
+func (c *chaos) planDelivery(async bool) eventChaos {
+	if c == nil {
+		return eventChaos{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	plan := eventChaos{delay: c.draw(c.config.EventDelay)}
+	if async && c.chance(c.config.OutOfOrderRate) {
+		plan.delay += c.draw(c.config.OutOfOrderDelay)
+	}
+	// Cap the run of failures so a rate of 1 cannot loop forever.
+	for plan.failures < 100 && c.chance(c.config.ProcessorFailureRate) {
+		plan.failures++
+	}
+	plan.duplicate = c.chance(c.config.DuplicateDeliveryRate)
+	return plan
+}
+
+func (c *chaos) draw(d Distribution) time.Duration {
+	if d == nil {
+		return 0
+	}
+	return d(c.rand)
+}
+
+func (c *chaos) chance(p float64) bool {
+	return p > 0 && c.rand.Float64() < p
+}
+
+// pause waits for d, or until ctx is done.
+func pause(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,92 @@
+package conqueress
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChaos(t *testing.T) {
+	var (
+		mediator *Mediator
+		runs     func(seed uint64) []int
+		first    []int
+		second   []int
+	)
+	ensure.That("the same seed makes the same decisions", func(s *ensure.Scenario) {
+		s.Given("a way to count deliveries under chaos with a seed", func() {
+			runs = func(seed uint64) []int {
+				m := NewMediator(false, WithChaos(ChaosConfig{
+					Seed:                  seed,
+					ProcessorFailureRate:  0.3,
+					DuplicateDeliveryRate: 0.3,
+				}), WithDefaultRetryPolicy(RetryPolicy{MaxRetries: 100}))
+				var calls int
+				_, _ = Subscribe(m, func(ctx context.Context, evt stockAdjusted) error {
+					calls++
+					return nil
+				})
+				counts := make([]int, 0, 20)
+				for i := 0; i < 20; i++ {
+					calls = 0
+					require.Nil(t, m.PublishSync(stockAdjusted{sku: "widget"}))
+					counts = append(counts, calls)
+				}
+				return counts
+			}
+		})
+
+		s.When("I publish the same events twice with the same seed", func() {
+			first = runs(42)
+			second = runs(42)
+		})
+
+		s.Then("processors should see the same deliveries", func() {
+			assert.Equal(t, first, second)
+			assert.Contains(t, first, 2, "some events should be delivered twice")
+		})
+	}, t)
+
+	ensure.That("injected failures follow the processor's retry policy", func(s *ensure.Scenario) {
+		var err error
+		s.Given("a mediator that always fails processors", func() {
+			mediator = NewMediator(false, WithChaos(ChaosConfig{Seed: 1, ProcessorFailureRate: 1}))
+			_, _ = Subscribe(mediator, func(ctx context.Context, evt stockAdjusted) error { return nil })
+		})
+
+		s.When("I publish an event", func() {
+			err = mediator.PublishSync(stockAdjusted{sku: "widget"})
+		})
+
+		s.Then("the injected failure should be reported", func() {
+			assert.True(t, errors.Is(err, ErrInjectedFailure))
+		})
+	}, t)
+
+	ensure.That("a chosen seed is reported and delays apply to commands", func(s *ensure.Scenario) {
+		var took time.Duration
+		s.Given("a mediator with a fixed command delay", func() {
+			mediator = NewMediator(false, WithChaos(ChaosConfig{
+				Seed:         7,
+				CommandDelay: UniformDelay(20*time.Millisecond, 20*time.Millisecond),
+			}))
+			_ = RegisterTypedCommandHandler(mediator, func(cmd createWidget) error { return nil })
+		})
+
+		s.When("I dispatch a command", func() {
+			start := time.Now()
+			require.Nil(t, mediator.DispatchSync(createWidget{"widget"}, nil))
+			took = time.Since(start)
+		})
+
+		s.Then("it should be delayed", func() {
+			assert.Equal(t, uint64(7), mediator.ChaosSeed())
+			assert.GreaterOrEqual(t, took, 20*time.Millisecond)
+		})
+	}, t)
+}
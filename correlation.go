@@ -0,0 +1,136 @@
+package conqueress
+
+import (
+	"context"
+
+	"github.com/iamkoch/conqueress/guid"
+)
+
+// Headers under which events carry their correlation and causation IDs.
+const (
+	CorrelationIdHeader = "correlation-id"
+	CausationIdHeader   = "causation-id"
+)
+
+// The correlation ID names the whole conversation a message belongs to: it
+// starts as the ID of the first command or event, and every command and event
+// that follows from it inherits it. The causation ID is the ID of the message
+// that directly led to this one.
+//
+// The mediator keeps both in the context. A command handler runs with the
+// command's ID as the causation ID, which the repositories record on the
+// events it saves. A processor runs with the event's ID as the causation ID
+// and the event's correlation ID, so the commands it dispatches, and those a
+// saga dispatches, stay in the same conversation.
+
+type correlationKey struct{}
+
+type correlation struct {
+	correlationId string
+	causationId   string
+}
+
+// ContextWithCorrelation returns a copy of ctx carrying the given correlation
+// and causation IDs. Use it to continue a conversation that started outside
+// the mediator, such as an incoming request.
+func ContextWithCorrelation(ctx context.Context, correlationId, causationId string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, correlation{correlationId, causationId})
+}
+
+// CorrelationIdFrom returns the correlation ID in ctx, or "" if there is none.
+func CorrelationIdFrom(ctx context.Context) string {
+	c, _ := ctx.Value(correlationKey{}).(correlation)
+	return c.correlationId
+}
+
+// CausationIdFrom returns the causation ID in ctx, or "" if there is none.
+func CausationIdFrom(ctx context.Context) string {
+	c, _ := ctx.Value(correlationKey{}).(correlation)
+	return c.causationId
+}
+
+// CorrelationIdOf returns the correlation ID recorded on evt, or "" if there
+// is none.
+func CorrelationIdOf(evt Event) string {
+	if hc, ok := evt.(HeaderCarrier); ok {
+		return hc.Header(CorrelationIdHeader)
+	}
+	return ""
+}
+
+// CausationIdOf returns the causation ID recorded on evt, or "" if there is
+// none.
+func CausationIdOf(evt Event) string {
+	if hc, ok := evt.(HeaderCarrier); ok {
+		return hc.Header(CausationIdHeader)
+	}
+	return ""
+}
+
+// InjectCorrelation records the correlation and causation IDs in ctx on evt,
+// if evt carries headers and does not have them already. Repositories call it
+// for every event they save.
+func InjectCorrelation(ctx context.Context, evt Event) {
+	SetCorrelation(evt, CorrelationIdFrom(ctx), CausationIdFrom(ctx))
+}
+
+// SetCorrelation records the given correlation and causation IDs on evt, if
+// evt carries headers, leaving any it already has. Empty IDs are not
+// recorded. Event stores that keep the IDs beside the event use it to put
+// them back when they load it.
+func SetCorrelation(evt Event, correlationId, causationId string) {
+	hc, ok := evt.(HeaderCarrier)
+	if !ok {
+		return
+	}
+	if correlationId != "" && hc.Header(CorrelationIdHeader) == "" {
+		hc.SetHeader(CorrelationIdHeader, correlationId)
+	}
+	if causationId != "" && hc.Header(CausationIdHeader) == "" {
+		hc.SetHeader(CausationIdHeader, causationId)
+	}
+}
+
+// commandContext returns the context cmd's handler runs with, whose causation
+// ID is the command's ID. The command starts a new conversation if ctx is not
+// part of one already.
+func commandContext(ctx context.Context, cmd Command) context.Context {
+	id := ""
+	if ic, ok := cmd.(IdentifiedCommand); ok {
+		id = ic.CommandID()
+	}
+	if id == "" {
+		id = guid.New().String()
+	}
+	correlationId := CorrelationIdFrom(ctx)
+	if correlationId == "" {
+		correlationId = id
+	}
+	return ContextWithCorrelation(ctx, correlationId, id)
+}
+
+// eventContext returns the context a processor of evt runs with, whose
+// causation ID is the event's ID and whose correlation ID, user and tenant
+// are the event's.
+func eventContext(ctx context.Context, evt Event) context.Context {
+	id := ""
+	if e, ok := evt.(identifiedEvent); ok {
+		id = e.messageId()
+	}
+	correlationId := CorrelationIdOf(evt)
+	if correlationId == "" {
+		correlationId = CorrelationIdFrom(ctx)
+	}
+	if correlationId == "" {
+		correlationId = id
+	}
+	if hc, ok := evt.(HeaderCarrier); ok {
+		if userId, tenantId := hc.Header(UserIdHeader), hc.Header(TenantIdHeader); userId != "" || tenantId != "" {
+			ctx = ContextWithIdentity(ctx, userId, tenantId)
+		}
+	}
+	if correlationId == "" && id == "" {
+		return ctx
+	}
+	return ContextWithCorrelation(ctx, correlationId, id)
+}
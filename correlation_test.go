@@ -0,0 +1,76 @@
+package conqueress
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type handlerIds struct {
+	correlationId string
+	causationId   string
+}
+
+func TestCorrelation(t *testing.T) {
+	var (
+		mediator *Mediator
+		seen     chan handlerIds
+	)
+	setup := func() {
+		mediator = NewMediator(false)
+		seen = make(chan handlerIds, 1)
+		_ = RegisterTypedContextCommandHandler(mediator, func(ctx context.Context, cmd placeOrder) error {
+			seen <- handlerIds{CorrelationIdFrom(ctx), CausationIdFrom(ctx)}
+			return nil
+		})
+	}
+
+	ensure.That("a command that starts a conversation is its own correlation and the cause of what follows", func(s *ensure.Scenario) {
+		s.Given("a mediator with a handler that records its IDs", setup)
+
+		s.When("I dispatch an identified command without a correlation", func() {
+			require.Nil(t, mediator.DispatchSync(placeOrder{id: "order-1"}, nil))
+		})
+
+		s.Then("the handler should see the command's ID as both", func() {
+			assert.Equal(t, handlerIds{"order-1", "order-1"}, <-seen)
+		})
+	}, t)
+
+	ensure.That("a command dispatched in a conversation keeps its correlation", func(s *ensure.Scenario) {
+		s.Given("a mediator with a handler that records its IDs", setup)
+
+		s.When("I dispatch a command under a correlation", func() {
+			ctx := ContextWithCorrelation(context.Background(), "checkout-1", "request-1")
+			require.Nil(t, mediator.DispatchContext(ctx, placeOrder{id: "order-2"}, nil))
+		})
+
+		s.Then("the handler should see the conversation's correlation and the command as the cause", func() {
+			assert.Equal(t, handlerIds{"checkout-1", "order-2"}, <-seen)
+		})
+	}, t)
+
+	ensure.That("commands dispatched by a processor inherit the event's correlation", func(s *ensure.Scenario) {
+		var shipped itemShipped
+		s.Given("a processor that dispatches a command for each event", func() {
+			setup()
+			_, _ = Subscribe(mediator, func(ctx context.Context, evt itemShipped) error {
+				assert.Equal(t, evt.MessageId, CausationIdFrom(ctx))
+				return mediator.DispatchSyncContext(ctx, placeOrder{id: "order-3"})
+			})
+		})
+
+		s.When("I publish an event that belongs to a conversation", func() {
+			shipped = NewEvent[itemShipped]()
+			SetCorrelation(shipped, "checkout-2", "order-0")
+			require.Nil(t, mediator.PublishSync(shipped))
+		})
+
+		s.Then("the command's handler should see the event's correlation", func() {
+			assert.Equal(t, handlerIds{"checkout-2", "order-3"}, <-seen)
+		})
+	}, t)
+}
@@ -0,0 +1,66 @@
+package conqueress
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/iamkoch/conqueress/guid"
+)
+
+// DeadLetterSink stores processor failures so they can be inspected and
+// replayed once whatever made the processor fail is fixed.
+type DeadLetterSink interface {
+	Put(ctx context.Context, failure ProcessorFailure) error
+}
+
+// InMemoryDeadLetterSink keeps failures in memory. It is safe for concurrent
+// use.
+type InMemoryDeadLetterSink struct {
+	mu       sync.Mutex
+	failures []ProcessorFailure
+}
+
+func NewInMemoryDeadLetterSink() *InMemoryDeadLetterSink {
+	return &InMemoryDeadLetterSink{}
+}
+
+func (s *InMemoryDeadLetterSink) Put(_ context.Context, failure ProcessorFailure) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, failure)
+	return nil
+}
+
+// Failures returns a copy of the stored failures, oldest first.
+func (s *InMemoryDeadLetterSink) Failures() []ProcessorFailure {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ProcessorFailure(nil), s.failures...)
+}
+
+// Remove deletes the failure with the given ID, typically after it has been
+// replayed successfully.
+func (s *InMemoryDeadLetterSink) Remove(id guid.Guid) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, f := range s.failures {
+		if f.Id == id {
+			s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			return
+		}
+	}
+}
+
+// Replay runs the processor named in failure on its event again, once,
+// through the event middleware. It returns the processor's error, and an
+// error if no processor of that name would receive the event.
+func (m *Mediator) Replay(ctx context.Context, failure ProcessorFailure) error {
+	reg := m.snapshot()
+	for _, r := range reg.processorsFor(failure.Event) {
+		if r.name == failure.Processor {
+			return reg.wrapEventProcessor(r.processor)(ctx, failure.Event)
+		}
+	}
+	return errors.New("no processor registered with name " + failure.Processor)
+}
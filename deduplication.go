@@ -0,0 +1,201 @@
+package conqueress
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// IdentifiedCommand is implemented by commands that carry an ID chosen by the
+// client, such as an idempotency key from an HTTP request. When the mediator
+// has a deduplication store, a command whose ID was already handled
+// successfully is not handled again: the original result is returned instead.
+// IDs only need to be unique among commands of the same type.
+type IdentifiedCommand interface {
+	CommandID() string
+}
+
+// ProcessedCommand records a command that was handled successfully. Result is
+// the handler's result encoded as JSON, or nil if it returned none.
+type ProcessedCommand struct {
+	CommandID   string
+	CommandType string
+	Result      []byte
+	ProcessedAt time.Time
+	ExpiresAt   time.Time
+}
+
+// DeduplicationStore remembers processed commands by type and ID, so commands
+// of different types may share an ID. Get returns nil, without an error, when
+// there is no record for the command or it has expired.
+type DeduplicationStore interface {
+	Get(ctx context.Context, commandType, commandID string) (*ProcessedCommand, error)
+	Put(ctx context.Context, record ProcessedCommand) error
+}
+
+const defaultDeduplicationWindow = 24 * time.Hour
+
+// WithDeduplication makes the mediator skip commands implementing
+// IdentifiedCommand whose ID store already holds, returning the result
+// recorded for them. Records are kept for window, or a day if window is not
+// positive. Only successful commands are recorded, so a client can retry a
+// command that failed with the same ID.
+//
+// A command's result is stored as JSON and decoded again when it is
+// returned for a repeat, into the result type of a handler registered with
+// RegisterCommandHandlerFor, or as a json.RawMessage otherwise.
+//
+// Within one mediator, a repeat that arrives while the command is being
+// handled waits for it to finish. Across processes, checking for a record and
+// recording the command are separate calls to store, so copies of a command
+// handled at the same moment by different processes can both run.
+// Deduplication is only best-effort there, and handlers that must never run
+// twice need to be idempotent themselves.
+func WithDeduplication(store DeduplicationStore, window time.Duration) MediatorOption {
+	return func(m *Mediator) {
+		if window <= 0 {
+			window = defaultDeduplicationWindow
+		}
+		m.deduplication = store
+		m.deduplicationWindow = window
+	}
+}
+
+// deduplicate runs handle unless cmd's ID has already been processed. Repeats
+// of a command that is still being handled wait for it to finish first.
+func (m *Mediator) deduplicate(ctx context.Context, cmd Command, resultType reflect.Type, handle func() (any, error)) (any, error) {
+	identified, ok := cmd.(IdentifiedCommand)
+	if !ok || m.deduplication == nil || identified.CommandID() == "" {
+		return handle()
+	}
+	id := identified.CommandID()
+	commandType := reflect.TypeOf(cmd).String()
+
+	release := m.claimCommandID(commandType + ":" + id)
+	defer release()
+
+	record, err := m.deduplication.Get(ctx, commandType, id)
+	if err != nil {
+		return nil, fmt.Errorf("checking for duplicate command %s: %w", id, err)
+	}
+	if record != nil {
+		slog.With(
+			"command", cmd,
+			"commandId", id,
+		).Info("Skipping duplicate command")
+		return decodeResult(record.Result, resultType)
+	}
+
+	result, err := handle()
+	if err != nil {
+		return result, err
+	}
+
+	encoded, err := encodeResult(result)
+	if err == nil {
+		now := time.Now().UTC()
+		err = m.deduplication.Put(ctx, ProcessedCommand{
+			CommandID:   id,
+			CommandType: commandType,
+			Result:      encoded,
+			ProcessedAt: now,
+			ExpiresAt:   now.Add(m.deduplicationWindow),
+		})
+	}
+	if err != nil {
+		// The command has been handled, so report that, but a repeat of it
+		// will run again.
+		slog.With(
+			"command", cmd,
+			"commandId", id,
+			"error", err,
+		).Warn("Failed to record processed command")
+	}
+	return result, nil
+}
+
+// claimCommandID blocks until no other goroutine is handling a command with
+// the same key, its type and ID, and marks it as being handled until the
+// returned function is called.
+func (m *Mediator) claimCommandID(id string) func() {
+	for {
+		m.deduplicating.Lock()
+		busy, ok := m.inflight[id]
+		if !ok {
+			done := make(chan struct{})
+			m.inflight[id] = done
+			m.deduplicating.Unlock()
+			return func() {
+				m.deduplicating.Lock()
+				delete(m.inflight, id)
+				m.deduplicating.Unlock()
+				close(done)
+			}
+		}
+		m.deduplicating.Unlock()
+		<-busy
+	}
+}
+
+func encodeResult(result any) ([]byte, error) {
+	if result == nil {
+		return nil, nil
+	}
+	return json.Marshal(result)
+}
+
+func decodeResult(encoded []byte, resultType reflect.Type) (any, error) {
+	if encoded == nil {
+		return nil, nil
+	}
+	if resultType == nil {
+		return json.RawMessage(encoded), nil
+	}
+	result := reflect.New(resultType)
+	if err := json.Unmarshal(encoded, result.Interface()); err != nil {
+		return nil, fmt.Errorf("decoding result of duplicate command: %w", err)
+	}
+	return result.Elem().Interface(), nil
+}
+
+// InMemoryDeduplicationStore keeps processed commands in memory, so it only
+// deduplicates within one process. It is safe for concurrent use.
+type InMemoryDeduplicationStore struct {
+	mu      sync.Mutex
+	records map[processedCommandKey]ProcessedCommand
+}
+
+type processedCommandKey struct {
+	commandType string
+	commandID   string
+}
+
+func NewInMemoryDeduplicationStore() *InMemoryDeduplicationStore {
+	return &InMemoryDeduplicationStore{records: make(map[processedCommandKey]ProcessedCommand)}
+}
+
+func (s *InMemoryDeduplicationStore) Get(_ context.Context, commandType, commandID string) (*ProcessedCommand, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := processedCommandKey{commandType, commandID}
+	record, ok := s.records[key]
+	if !ok {
+		return nil, nil
+	}
+	if time.Now().After(record.ExpiresAt) {
+		delete(s.records, key)
+		return nil, nil
+	}
+	return &record, nil
+}
+
+func (s *InMemoryDeduplicationStore) Put(_ context.Context, record ProcessedCommand) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[processedCommandKey{record.CommandType, record.CommandID}] = record
+	return nil
+}
@@ -0,0 +1,132 @@
+package conqueress
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type placeOrder struct {
+	id  string
+	sku string
+}
+
+func (p placeOrder) CommandID() string {
+	return p.id
+}
+
+type cancelOrder struct {
+	id string
+}
+
+func (c cancelOrder) CommandID() string {
+	return c.id
+}
+
+func TestDeduplication(t *testing.T) {
+	var (
+		mediator *Mediator
+		handled  int
+		fail     bool
+		first    CommandResult
+		second   CommandResult
+		err      error
+	)
+	register := func() {
+		handled, fail = 0, false
+		require.Nil(t, RegisterCommandHandlerFor(mediator, func(ctx context.Context, cmd placeOrder) (CommandResult, error) {
+			if fail {
+				return CommandResult{}, errors.New("out of stock")
+			}
+			handled++
+			return CommandResult{AggregateId: cmd.sku, Version: handled}, nil
+		}))
+	}
+
+	ensure.That("a repeated command ID returns the original result without handling it again", func(s *ensure.Scenario) {
+		s.Given("a mediator with a deduplication store", func() {
+			mediator = NewMediator(false, WithDeduplication(NewInMemoryDeduplicationStore(), time.Minute))
+			register()
+		})
+
+		s.When("I dispatch the same command twice", func() {
+			first, err = DispatchFor[placeOrder, CommandResult](context.Background(), mediator, placeOrder{"order-1", "widget"})
+			require.Nil(t, err)
+			second, err = DispatchFor[placeOrder, CommandResult](context.Background(), mediator, placeOrder{"order-1", "widget"})
+		})
+
+		s.Then("it should be handled once and return the same result", func() {
+			assert.Nil(t, err)
+			assert.Equal(t, 1, handled)
+			assert.Equal(t, first, second)
+		})
+	}, t)
+
+	ensure.That("a failed command can be retried with the same ID", func(s *ensure.Scenario) {
+		s.Given("a mediator whose handler fails once", func() {
+			mediator = NewMediator(false, WithDeduplication(NewInMemoryDeduplicationStore(), time.Minute))
+			register()
+			fail = true
+			_, err = DispatchFor[placeOrder, CommandResult](context.Background(), mediator, placeOrder{"order-2", "widget"})
+			require.NotNil(t, err)
+			fail = false
+		})
+
+		s.When("I retry it", func() {
+			first, err = DispatchFor[placeOrder, CommandResult](context.Background(), mediator, placeOrder{"order-2", "widget"})
+		})
+
+		s.Then("it should be handled", func() {
+			assert.Nil(t, err)
+			assert.Equal(t, 1, handled)
+			assert.Equal(t, CommandResult{AggregateId: "widget", Version: 1}, first)
+		})
+	}, t)
+
+	ensure.That("a command ID is forgotten once its window has passed", func(s *ensure.Scenario) {
+		s.Given("a mediator with a short window", func() {
+			mediator = NewMediator(false, WithDeduplication(NewInMemoryDeduplicationStore(), time.Millisecond))
+			register()
+			_, err = DispatchFor[placeOrder, CommandResult](context.Background(), mediator, placeOrder{"order-3", "widget"})
+			require.Nil(t, err)
+		})
+
+		s.When("I repeat the command after the window", func() {
+			time.Sleep(5 * time.Millisecond)
+			_, err = DispatchFor[placeOrder, CommandResult](context.Background(), mediator, placeOrder{"order-3", "widget"})
+		})
+
+		s.Then("it should be handled again", func() {
+			assert.Nil(t, err)
+			assert.Equal(t, 2, handled)
+		})
+	}, t)
+
+	ensure.That("commands of different types may share an ID", func(s *ensure.Scenario) {
+		var cancelled int
+		s.Given("a mediator with a deduplication store and a command already handled", func() {
+			mediator = NewMediator(false, WithDeduplication(NewInMemoryDeduplicationStore(), time.Minute))
+			register()
+			require.Nil(t, RegisterCommandHandlerFor(mediator, func(ctx context.Context, cmd cancelOrder) (CommandResult, error) {
+				cancelled++
+				return CommandResult{AggregateId: cmd.id}, nil
+			}))
+			_, err = DispatchFor[placeOrder, CommandResult](context.Background(), mediator, placeOrder{"order-4", "widget"})
+			require.Nil(t, err)
+		})
+
+		s.When("I dispatch a command of another type with the same ID", func() {
+			_, err = DispatchFor[cancelOrder, CommandResult](context.Background(), mediator, cancelOrder{"order-4"})
+		})
+
+		s.Then("it should be handled", func() {
+			assert.Nil(t, err)
+			assert.Equal(t, 1, cancelled)
+		})
+	}, t)
+}
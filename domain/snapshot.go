@@ -0,0 +1,16 @@
+package domain
+
+// Snapshotter is implemented by aggregates whose state can be saved as a
+// snapshot, so a repository that keeps snapshots can load them without
+// replaying every event.
+//
+// Snapshot returns the aggregate's state, and RestoreSnapshot puts it back on
+// a freshly constructed aggregate. SnapshotSchema identifies the format
+// Snapshot writes. Change it whenever that format changes, and snapshots
+// written in the old one are ignored and the aggregate is replayed from its
+// events instead.
+type Snapshotter interface {
+	SnapshotSchema() int
+	Snapshot() ([]byte, error)
+	RestoreSnapshot(data []byte) error
+}
@@ -3,6 +3,7 @@ package conqueress
 import (
 	"github.com/iamkoch/conqueress/guid"
 	"reflect"
+	"time"
 )
 
 type Event interface {
@@ -12,8 +13,22 @@ type Event interface {
 }
 
 type BaseEvent struct {
-	MessageId string `json:"message_id"`
-	Ver       int    `json:"version"`
+	MessageId  string            `json:"message_id"`
+	Ver        int               `json:"version"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	OccurredAt time.Time         `json:"occurred_at"`
+
+	stored storedMetadata
+}
+
+// HeaderCarrier is implemented by events that carry headers alongside their
+// payload, as every event embedding BaseEvent does. Headers are stored with
+// the event, and are how trace context travels from the command that raised
+// an event to the processors that handle it.
+type HeaderCarrier interface {
+	Header(key string) string
+	SetHeader(key, value string)
+	HeaderKeys() []string
 }
 
 func (b *BaseEvent) Version() int {
@@ -24,12 +39,44 @@ func (b *BaseEvent) MsgId() guid.Guid {
 	return guid.MustFromString(b.MessageId)
 }
 
+// identifiedEvent is implemented by events embedding BaseEvent. Unlike
+// MsgId, messageId does not panic when the event has no ID.
+type identifiedEvent interface {
+	messageId() string
+}
+
+func (b *BaseEvent) messageId() string {
+	if b == nil {
+		return ""
+	}
+	return b.MessageId
+}
+
 func (b *BaseEvent) WithVersion(v int) {
 	b.Ver = v
 }
 
+func (b *BaseEvent) Header(key string) string {
+	return b.Headers[key]
+}
+
+func (b *BaseEvent) SetHeader(key, value string) {
+	if b.Headers == nil {
+		b.Headers = make(map[string]string)
+	}
+	b.Headers[key] = value
+}
+
+func (b *BaseEvent) HeaderKeys() []string {
+	keys := make([]string, 0, len(b.Headers))
+	for k := range b.Headers {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
 func defaultBaseEvent() *BaseEvent {
-	return &BaseEvent{Ver: -1, MessageId: guid.New().String()}
+	return &BaseEvent{Ver: -1, MessageId: guid.New().String(), OccurredAt: time.Now().UTC()}
 }
 
 // NewEvent creates a new instance of the specified type T and populates its BaseEvent field if present and settable.
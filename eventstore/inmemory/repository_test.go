@@ -1,7 +1,10 @@
 package inmemory
 
 import (
+	"context"
+	"errors"
 	"reflect"
+	"strconv"
 	"testing"
 
 	cqrs "github.com/iamkoch/conqueress"
@@ -9,6 +12,10 @@ import (
 	"github.com/iamkoch/conqueress/eventstore"
 	"github.com/iamkoch/conqueress/guid"
 	. "github.com/smartystreets/goconvey/convey"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 type User struct {
@@ -84,3 +91,358 @@ func TestRepository(t *testing.T) {
 		So(cap, ShouldNotBeNil)
 	})
 }
+
+func TestRepositoryTracing(t *testing.T) {
+	Convey("saving under a traced context records spans and the trace on the events", t, func() {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		otel.SetTracerProvider(provider)
+		defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+		m := cqrs.NewMediator(false)
+		storage := NewInMemoryEventStore[guid.Guid](m)
+		repo := eventstore.NewRepository[*User](storage, domain.GetDefaultAggregate[User])
+		m.RegisterEventHandler(reflect.TypeOf(UserCreated{}), func(e cqrs.Event) error { return nil })
+
+		agg := NewUser2()
+		id := guid.New()
+		created := UserCreated{&cqrs.BaseEvent{
+			MessageId: guid.New().String(),
+			Ver:       -1,
+		}, id, "bob"}
+		agg.ApplyChange(created)
+
+		ctx, span := provider.Tracer("test").Start(context.Background(), "command")
+		err := repo.SaveContext(ctx, agg, -1)
+		span.End()
+		So(err, ShouldBeNil)
+
+		names := make([]string, 0)
+		for _, s := range recorder.Ended() {
+			So(s.SpanContext().TraceID(), ShouldEqual, span.SpanContext().TraceID())
+			names = append(names, s.Name())
+		}
+		So(names, ShouldContain, "Repository.Save")
+		So(names, ShouldContain, "SaveEvents")
+		So(cqrs.TraceContextFrom(created).TraceID(), ShouldEqual, span.SpanContext().TraceID())
+	})
+}
+
+func TestRepositoryCorrelation(t *testing.T) {
+	Convey("saving under a command's context records its correlation and causation on the events", t, func() {
+		m := cqrs.NewMediator(false)
+		storage := NewInMemoryEventStore[guid.Guid](m)
+		repo := eventstore.NewRepository[*User](storage, domain.GetDefaultAggregate[User])
+		m.RegisterEventHandler(reflect.TypeOf(UserCreated{}), func(e cqrs.Event) error { return nil })
+
+		agg := NewUser2()
+		id := guid.New()
+		created := UserCreated{&cqrs.BaseEvent{
+			MessageId: guid.New().String(),
+			Ver:       -1,
+		}, id, "bob"}
+		agg.ApplyChange(created)
+
+		ctx := cqrs.ContextWithCorrelation(context.Background(), "signup-1", "create-user-1")
+		So(repo.SaveContext(ctx, agg, -1), ShouldBeNil)
+
+		loaded := storage.GetEventsForAggregate(id)
+		So(loaded, ShouldHaveLength, 1)
+		So(cqrs.CorrelationIdOf(loaded[0]), ShouldEqual, "signup-1")
+		So(cqrs.CausationIdOf(loaded[0]), ShouldEqual, "create-user-1")
+	})
+}
+
+func TestStoredMetadata(t *testing.T) {
+	Convey("saved events carry the metadata the store assigns", t, func() {
+		m := cqrs.NewMediator(false)
+		storage := NewInMemoryEventStore[guid.Guid](m)
+		repo := eventstore.NewRepository[*User](storage, domain.GetDefaultAggregate[User])
+		m.RegisterEventHandler(reflect.TypeOf(UserCreated{}), func(e cqrs.Event) error { return nil })
+
+		first, second := NewUser2(), NewUser2()
+		firstId, secondId := guid.New(), guid.New()
+		first.ApplyChange(UserCreated{cqrs.NewEvent[UserCreated]().BaseEvent, firstId, "bob"})
+		second.ApplyChange(UserCreated{cqrs.NewEvent[UserCreated]().BaseEvent, secondId, "alice"})
+
+		ctx := cqrs.ContextWithIdentity(context.Background(), "user-1", "tenant-1")
+		So(repo.SaveContext(ctx, first, -1), ShouldBeNil)
+		So(repo.SaveContext(ctx, second, -1), ShouldBeNil)
+
+		md := cqrs.MetadataOf(storage.GetEventsForAggregate(secondId)[0])
+		So(md.AggregateId, ShouldEqual, secondId.String())
+		So(md.AggregateType, ShouldEqual, "User")
+		So(md.Version, ShouldEqual, 0)
+		So(md.Position, ShouldEqual, 2)
+		So(md.UserId, ShouldEqual, "user-1")
+		So(md.TenantId, ShouldEqual, "tenant-1")
+		So(md.OccurredAt.IsZero(), ShouldBeFalse)
+		So(md.RecordedAt.Before(md.OccurredAt), ShouldBeFalse)
+	})
+}
+
+func TestReadAll(t *testing.T) {
+	Convey("every saved event can be read in order of global position", t, func() {
+		m := cqrs.NewMediator(false)
+		storage := NewInMemoryEventStore[guid.Guid](m)
+		repo := eventstore.NewRepository[*User](storage, domain.GetDefaultAggregate[User])
+		m.RegisterEventHandler(reflect.TypeOf(UserCreated{}), func(e cqrs.Event) error { return nil })
+
+		for _, name := range []string{"bob", "alice", "carol"} {
+			u := NewUser2()
+			u.ApplyChange(UserCreated{cqrs.NewEvent[UserCreated]().BaseEvent, guid.New(), name})
+			So(repo.Save(u, -1), ShouldBeNil)
+		}
+
+		reader := storage.(eventstore.IAllEventsReader)
+		events, err := reader.ReadAll(context.Background(), 1, 10)
+		So(err, ShouldBeNil)
+		So(events, ShouldHaveLength, 2)
+		So(events[0].Position, ShouldEqual, 2)
+		So(events[0].Event.(UserCreated).name, ShouldEqual, "alice")
+		So(events[1].Event.(UserCreated).name, ShouldEqual, "carol")
+
+		events, err = reader.ReadAll(context.Background(), 0, 1)
+		So(err, ShouldBeNil)
+		So(events, ShouldHaveLength, 1)
+		So(events[0].Position, ShouldEqual, 1)
+	})
+}
+
+type UserRenamed struct {
+	*cqrs.BaseEvent
+	name string
+}
+
+func TestStreamReads(t *testing.T) {
+	Convey("events can be read by aggregate type and by event type in order of position", t, func() {
+		m := cqrs.NewMediator(false)
+		storage := NewInMemoryEventStore[guid.Guid](m)
+		m.RegisterEventHandler(reflect.TypeOf(UserCreated{}), func(e cqrs.Event) error { return nil })
+		m.RegisterEventHandler(reflect.TypeOf(UserRenamed{}), func(e cqrs.Event) error { return nil })
+
+		bob, team := guid.New(), guid.New()
+		So(storage.SaveEvents("User", bob, []cqrs.Event{
+			UserCreated{cqrs.NewEvent[UserCreated]().BaseEvent, bob, "bob"},
+		}, -1), ShouldBeNil)
+		So(storage.SaveEvents("Team", team, []cqrs.Event{
+			UserCreated{cqrs.NewEvent[UserCreated]().BaseEvent, team, "team"},
+		}, -1), ShouldBeNil)
+		So(storage.SaveEvents("User", bob, []cqrs.Event{
+			UserRenamed{cqrs.NewEvent[UserRenamed]().BaseEvent, "robert"},
+		}, 0), ShouldBeNil)
+
+		reader := storage.(eventstore.IStreamReader)
+		users, err := reader.ReadAggregateType(context.Background(), "User", 0, 10)
+		So(err, ShouldBeNil)
+		So(users, ShouldHaveLength, 2)
+		So(users[0].Position, ShouldEqual, 1)
+		So(users[1].Position, ShouldEqual, 3)
+
+		renames, err := reader.ReadEventTypes(context.Background(), []string{eventstore.EventTypeName(UserRenamed{})}, 0, 10)
+		So(err, ShouldBeNil)
+		So(renames, ShouldHaveLength, 1)
+		So(renames[0].Event.(UserRenamed).name, ShouldEqual, "robert")
+
+		paged, err := eventstore.AggregateTypeReader(reader, "User").ReadAll(context.Background(), 1, 10)
+		So(err, ShouldBeNil)
+		So(paged, ShouldHaveLength, 1)
+		So(paged[0].Position, ShouldEqual, 3)
+	})
+}
+
+func TestVersionRangeReads(t *testing.T) {
+	Convey("part of an aggregate's stream can be read by version", t, func() {
+		m := cqrs.NewMediator(false)
+		storage := NewInMemoryEventStore[guid.Guid](m)
+		m.RegisterEventHandler(reflect.TypeOf(UserCreated{}), func(e cqrs.Event) error { return nil })
+		m.RegisterEventHandler(reflect.TypeOf(UserRenamed{}), func(e cqrs.Event) error { return nil })
+
+		id := guid.New()
+		events := []cqrs.Event{UserCreated{cqrs.NewEvent[UserCreated]().BaseEvent, id, "bob"}}
+		for _, name := range []string{"rob", "robert", "bobby"} {
+			events = append(events, UserRenamed{cqrs.NewEvent[UserRenamed]().BaseEvent, name})
+		}
+		So(storage.SaveEvents("User", id, events, -1), ShouldBeNil)
+
+		reader := storage.(eventstore.IVersionRangeEventStore[guid.Guid])
+		from, err := reader.GetEventsForAggregateFrom(context.Background(), id, 2)
+		So(err, ShouldBeNil)
+		So(from, ShouldHaveLength, 2)
+		So(from[0].(UserRenamed).name, ShouldEqual, "robert")
+		So(from[1].(UserRenamed).name, ShouldEqual, "bobby")
+
+		between, err := reader.GetEventsForAggregateRange(context.Background(), id, 1, 2)
+		So(err, ShouldBeNil)
+		So(between, ShouldHaveLength, 2)
+		So(between[0].(UserRenamed).name, ShouldEqual, "rob")
+		So(cqrs.MetadataOf(between[1]).Version, ShouldEqual, 2)
+	})
+}
+
+var accountSchema = 1
+
+type Account struct {
+	domain.AggregateRootBase[guid.Guid]
+	balance  int
+	replayed int
+}
+
+type AccountOpened struct {
+	*cqrs.BaseEvent
+	id guid.Guid
+}
+
+type MoneyDeposited struct {
+	*cqrs.BaseEvent
+	amount int
+}
+
+func (a *Account) SetBase(base domain.AggregateRootBase[guid.Guid]) {
+	a.AggregateRootBase = base
+}
+
+func (a *Account) GetHandler() func(e cqrs.Event) {
+	return func(e cqrs.Event) {
+		a.replayed++
+		a.SetVersion(e.Version())
+		switch evt := e.(type) {
+		case AccountOpened:
+			a.SetId(evt.id)
+		case MoneyDeposited:
+			a.balance += evt.amount
+		}
+	}
+}
+
+func (a *Account) SetInnerApply(ia func(e cqrs.Event)) {
+	a.AggregateRootBase.SetInnerApply(ia)
+}
+
+func (a *Account) SnapshotSchema() int {
+	return accountSchema
+}
+
+func (a *Account) Snapshot() ([]byte, error) {
+	return []byte(strconv.Itoa(a.balance)), nil
+}
+
+func (a *Account) RestoreSnapshot(data []byte) (err error) {
+	a.balance, err = strconv.Atoi(string(data))
+	return err
+}
+
+// countingSnapshotStore counts how many times the latest snapshot is read.
+type countingSnapshotStore struct {
+	*eventstore.InMemorySnapshotStore
+	reads int
+}
+
+func (s *countingSnapshotStore) LatestSnapshot(ctx context.Context, aggregateId string) (eventstore.Snapshot, error) {
+	s.reads++
+	return s.InMemorySnapshotStore.LatestSnapshot(ctx, aggregateId)
+}
+
+func TestSnapshotRepository(t *testing.T) {
+	Convey("a snapshotting repository loads the newest snapshot and replays only later events", t, func() {
+		m := cqrs.NewMediator(false)
+		storage := NewInMemoryEventStore[guid.Guid](m)
+		snapshots := &countingSnapshotStore{InMemorySnapshotStore: eventstore.NewInMemorySnapshotStore()}
+		repo := eventstore.NewSnapshotRepository[*Account](storage, snapshots, domain.GetDefaultAggregate[Account],
+			eventstore.WithSnapshotPolicy(eventstore.EveryNEvents(3)))
+		m.RegisterEventHandler(reflect.TypeOf(AccountOpened{}), func(e cqrs.Event) error { return nil })
+		m.RegisterEventHandler(reflect.TypeOf(MoneyDeposited{}), func(e cqrs.Event) error { return nil })
+
+		id := guid.New()
+		account := domain.GetDefaultAggregate[Account]()
+		account.ApplyChange(AccountOpened{cqrs.NewEvent[AccountOpened]().BaseEvent, id})
+		account.ApplyChange(MoneyDeposited{cqrs.NewEvent[MoneyDeposited]().BaseEvent, 10})
+		account.ApplyChange(MoneyDeposited{cqrs.NewEvent[MoneyDeposited]().BaseEvent, 20})
+		So(repo.Save(account, -1), ShouldBeNil)
+
+		snapshot, err := snapshots.LatestSnapshot(context.Background(), id.String())
+		So(err, ShouldBeNil)
+		So(snapshot.Version, ShouldEqual, 2)
+		So(snapshot.AggregateType, ShouldEqual, "Account")
+
+		So(storage.SaveEvents("Account", id, []cqrs.Event{
+			MoneyDeposited{cqrs.NewEvent[MoneyDeposited]().BaseEvent, 5},
+		}, 2), ShouldBeNil)
+
+		loaded, err := repo.GetById(id)
+		So(err, ShouldBeNil)
+		So(loaded.replayed, ShouldEqual, 1)
+		So(loaded.balance, ShouldEqual, 35)
+		So(loaded.Id(), ShouldEqual, id)
+		So(loaded.Version(), ShouldEqual, 3)
+
+		Convey("and replays every event when the snapshot's schema is stale", func() {
+			accountSchema = 2
+			defer func() { accountSchema = 1 }()
+
+			loaded, err := repo.GetById(id)
+			So(err, ShouldBeNil)
+			So(loaded.replayed, ShouldEqual, 4)
+			So(loaded.balance, ShouldEqual, 35)
+
+			Convey("and snapshots it in the new schema on its next save", func() {
+				loaded.ApplyChange(MoneyDeposited{cqrs.NewEvent[MoneyDeposited]().BaseEvent, 1})
+				So(repo.Save(loaded, 3), ShouldBeNil)
+
+				snapshot, err := snapshots.LatestSnapshot(context.Background(), id.String())
+				So(err, ShouldBeNil)
+				So(snapshot.Version, ShouldEqual, 4)
+				So(snapshot.Schema, ShouldEqual, 2)
+			})
+		})
+
+		Convey("and does not read the snapshot again to save an aggregate it loaded", func() {
+			reads := snapshots.reads
+			loaded.ApplyChange(MoneyDeposited{cqrs.NewEvent[MoneyDeposited]().BaseEvent, 1})
+			So(repo.Save(loaded, 3), ShouldBeNil)
+			So(snapshots.reads, ShouldEqual, reads)
+		})
+	})
+}
+
+func TestFailingProcessor(t *testing.T) {
+	Convey("a processor that fails does not fail the save", t, func() {
+		m := cqrs.NewMediator(false)
+		storage := NewInMemoryEventStore[guid.Guid](m)
+		repo := eventstore.NewRepository[*User](storage, domain.GetDefaultAggregate[User])
+		_, err := cqrs.Subscribe(m, func(ctx context.Context, e UserCreated) error {
+			return errors.New("read model unavailable")
+		})
+		So(err, ShouldBeNil)
+
+		id := guid.New()
+		u := NewUser2()
+		u.ApplyChange(UserCreated{cqrs.NewEvent[UserCreated]().BaseEvent, id, "bob"})
+
+		So(repo.Save(u, -1), ShouldBeNil)
+		So(storage.GetEventsForAggregate(id), ShouldHaveLength, 1)
+	})
+}
+
+func TestSaveWithResult(t *testing.T) {
+	Convey("saving with a result reports the version and position the store assigned", t, func() {
+		m := cqrs.NewMediator(false)
+		storage := NewInMemoryEventStore[guid.Guid](m)
+		repo := eventstore.NewRepository[*User](storage, domain.GetDefaultAggregate[User])
+		m.RegisterEventHandler(reflect.TypeOf(UserCreated{}), func(e cqrs.Event) error { return nil })
+
+		other := NewUser2()
+		other.ApplyChange(UserCreated{cqrs.NewEvent[UserCreated]().BaseEvent, guid.New(), "alice"})
+		So(repo.Save(other, -1), ShouldBeNil)
+
+		id := guid.New()
+		u := NewUser2()
+		u.ApplyChange(UserCreated{cqrs.NewEvent[UserCreated]().BaseEvent, id, "bob"})
+
+		result, err := eventstore.SaveWithResult(context.Background(), repo, u, -1)
+		So(err, ShouldBeNil)
+		So(result.AggregateId, ShouldEqual, id.String())
+		So(result.Version, ShouldEqual, 0)
+		So(result.Position, ShouldEqual, 2)
+	})
+}
@@ -1,11 +1,22 @@
 package inmemory
 
 import (
+	"context"
 	"fmt"
 	cqrs "github.com/iamkoch/conqueress"
 	"github.com/iamkoch/conqueress/eventstore"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"time"
 )
 
+var tracer = otel.Tracer("github.com/iamkoch/conqueress/eventstore/inmemory")
+
 type inMemoryEventDescriptor[TID comparable] struct {
 	version   int
 	eventData cqrs.Event
@@ -15,49 +26,123 @@ type inMemoryEventDescriptor[TID comparable] struct {
 type inMemoryEventStore[TID comparable] struct {
 	publisher *cqrs.Mediator
 	current   map[TID][]inMemoryEventDescriptor[TID]
+	log       *eventLog
+}
+
+// eventLog holds every event the store has saved, in order of position. It
+// has its own lock, so subscriptions can read it while events are saved.
+type eventLog struct {
+	mu       sync.RWMutex
+	position int64
+	events   []loggedEvent
 }
 
+type loggedEvent struct {
+	eventstore.PositionedEvent
+	aggregateType string
+	eventType     string
+}
+
+// NewInMemoryEventStore returns a store that keeps events in memory and
+// publishes them through m once it has saved them. Failures to publish are
+// logged, and do not fail the save. It also implements
+// eventstore.IAllEventsReader, eventstore.IStreamReader and
+// eventstore.IVersionRangeEventStore. It is not safe for concurrent saves.
 func NewInMemoryEventStore[TID comparable](m *cqrs.Mediator) eventstore.IGenericIDEventStore[TID] {
 	return &inMemoryEventStore[TID]{
 		m,
 		make(map[TID][]inMemoryEventDescriptor[TID]),
+		&eventLog{},
 	}
 }
 
+func (l *eventLog) nextPosition() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.position++
+	return l.position
+}
+
+func (l *eventLog) append(events []loggedEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, events...)
+}
+
 func (i inMemoryEventStore[TID]) SaveEvents(aggregateType string, aggregateId TID, events []cqrs.Event, expectedVersion int) error {
+	return i.SaveEventsContext(context.Background(), aggregateType, aggregateId, events, expectedVersion)
+}
+
+func (i inMemoryEventStore[TID]) SaveEventsContext(ctx context.Context, aggregateType string, aggregateId TID, events []cqrs.Event, expectedVersion int) (err error) {
+	ctx, span := tracer.Start(ctx, "SaveEvents", trace.WithAttributes(
+		eventstore.AggregateTypeKey.String(aggregateType),
+		eventstore.AggregateIdKey.String(fmt.Sprint(aggregateId)),
+		eventstore.EventCountKey.Int(len(events)),
+	))
+	defer func() { eventstore.EndSpan(span, err) }()
+
 	eventDescriptors, ok := i.current[aggregateId]
 
-	if !ok {
+	// An expected version of -1 asserts that the aggregate does not exist yet.
+	current := -1
+	if ok {
+		current = eventDescriptors[len(eventDescriptors)-1].version
+	} else {
 		eventDescriptors = []inMemoryEventDescriptor[TID]{}
-	} else if eventDescriptors[len(eventDescriptors)-1].version != expectedVersion && expectedVersion != -1 {
-		return fmt.Errorf("concurrency exception: %d != %d", eventDescriptors[len(eventDescriptors)-1].version, expectedVersion)
+	}
+	if current != expectedVersion {
+		eventstore.CountConcurrencyConflict(aggregateType)
+		return fmt.Errorf("%w: %d != %d", eventstore.ErrConcurrencyException, current, expectedVersion)
 	}
 
 	var ev = expectedVersion
 
+	recordedAt := time.Now().UTC()
+	logged := make([]loggedEvent, 0, len(events))
 	for _, evt := range events {
 		ev++
-		evt.WithVersion(ev)
+		position := i.log.nextPosition()
+		eventstore.Record(evt, aggregateType, fmt.Sprint(aggregateId), ev, position, recordedAt)
+		logged = append(logged, loggedEvent{
+			PositionedEvent: eventstore.PositionedEvent{Position: position, Event: evt},
+			aggregateType:   aggregateType,
+			eventType:       eventstore.EventTypeName(evt),
+		})
 		eventDescriptors = append(eventDescriptors, inMemoryEventDescriptor[TID]{
 			version:   ev,
 			eventData: evt,
 			id:        aggregateId,
 		})
+	}
 
-		// publish
-		err := i.publisher.PublishSync(evt)
+	i.current[aggregateId] = eventDescriptors
+	i.log.append(logged)
 
-		if err != nil {
-			return fmt.Errorf("error publishing event: %v", err)
+	// The events are saved, so a processor that fails does not fail the
+	// save. Its retry policy and dead letters deal with the failure.
+	for _, evt := range events {
+		if err := i.publisher.PublishSyncContext(ctx, evt); err != nil {
+			slog.With(
+				"error", err,
+				"event_type", eventstore.EventTypeName(evt),
+				"aggregate_id", fmt.Sprint(aggregateId),
+			).Error("Failed to publish saved event")
 		}
 	}
 
-	i.current[aggregateId] = eventDescriptors
-
 	return nil
 }
 
 func (i inMemoryEventStore[TID]) GetEventsForAggregate(aggregateId TID) []cqrs.Event {
+	return i.GetEventsForAggregateContext(context.Background(), aggregateId)
+}
+
+func (i inMemoryEventStore[TID]) GetEventsForAggregateContext(ctx context.Context, aggregateId TID) []cqrs.Event {
+	_, span := tracer.Start(ctx, "GetEventsForAggregate", trace.WithAttributes(
+		eventstore.AggregateIdKey.String(fmt.Sprint(aggregateId)),
+	))
+	defer span.End()
+
 	eventDescriptors, ok := i.current[aggregateId]
 	evs := make([]cqrs.Event, 0)
 	if !ok {
@@ -70,3 +155,58 @@ func (i inMemoryEventStore[TID]) GetEventsForAggregate(aggregateId TID) []cqrs.E
 
 	return evs
 }
+
+func (i inMemoryEventStore[TID]) GetEventsForAggregateFrom(ctx context.Context, aggregateId TID, fromVersion int) ([]cqrs.Event, error) {
+	return i.GetEventsForAggregateRange(ctx, aggregateId, fromVersion, math.MaxInt)
+}
+
+func (i inMemoryEventStore[TID]) GetEventsForAggregateRange(ctx context.Context, aggregateId TID, fromVersion, toVersion int) ([]cqrs.Event, error) {
+	_, span := tracer.Start(ctx, "GetEventsForAggregateRange", trace.WithAttributes(
+		eventstore.AggregateIdKey.String(fmt.Sprint(aggregateId)),
+	))
+	defer span.End()
+
+	evs := make([]cqrs.Event, 0)
+	for _, d := range i.current[aggregateId] {
+		if d.version >= fromVersion && d.version <= toVersion {
+			evs = append(evs, d.eventData)
+		}
+	}
+	return evs, nil
+}
+
+func (i inMemoryEventStore[TID]) ReadAll(_ context.Context, after int64, limit int) ([]eventstore.PositionedEvent, error) {
+	return i.log.read(after, limit, func(loggedEvent) bool { return true }), nil
+}
+
+func (i inMemoryEventStore[TID]) ReadAggregateType(_ context.Context, aggregateType string, after int64, limit int) ([]eventstore.PositionedEvent, error) {
+	return i.log.read(after, limit, func(e loggedEvent) bool {
+		return e.aggregateType == aggregateType
+	}), nil
+}
+
+func (i inMemoryEventStore[TID]) ReadEventTypes(_ context.Context, eventTypes []string, after int64, limit int) ([]eventstore.PositionedEvent, error) {
+	return i.log.read(after, limit, func(e loggedEvent) bool {
+		return slices.Contains(eventTypes, e.eventType)
+	}), nil
+}
+
+// read returns up to limit events after the given position that match.
+func (l *eventLog) read(after int64, limit int, match func(loggedEvent) bool) []eventstore.PositionedEvent {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	start := sort.Search(len(l.events), func(n int) bool {
+		return l.events[n].Position > after
+	})
+	events := make([]eventstore.PositionedEvent, 0)
+	for _, e := range l.events[start:] {
+		if len(events) == limit {
+			break
+		}
+		if match(e) {
+			events = append(events, e.PositionedEvent)
+		}
+	}
+	return events
+}
@@ -0,0 +1,35 @@
+package eventstore
+
+import (
+	"time"
+
+	"github.com/iamkoch/conqueress"
+)
+
+// Record sets the metadata an event store assigns on evt as it saves it, and
+// returns the event's metadata for the store to write alongside it. The time
+// the event occurred defaults to recordedAt. Events that do not carry
+// metadata only have their version set.
+func Record(evt conqueress.Event, aggregateType, aggregateId string, version int, position int64, recordedAt time.Time) conqueress.Metadata {
+	md := conqueress.MetadataOf(evt)
+	if md.OccurredAt.IsZero() {
+		md.OccurredAt = recordedAt
+	}
+	md.RecordedAt = recordedAt
+	md.AggregateType = aggregateType
+	md.AggregateId = aggregateId
+	md.Version = version
+	md.Position = position
+	Restore(evt, md)
+	return md
+}
+
+// Restore puts the metadata an event store kept alongside evt back on it when
+// the event is loaded.
+func Restore(evt conqueress.Event, md conqueress.Metadata) {
+	if mc, ok := evt.(conqueress.MetadataCarrier); ok {
+		mc.SetMetadata(md)
+		return
+	}
+	evt.WithVersion(md.Version)
+}
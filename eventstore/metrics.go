@@ -0,0 +1,37 @@
+package eventstore
+
+import (
+	"time"
+
+	"github.com/iamkoch/conqueress/metrics"
+)
+
+// Metrics recorded by the repositories and the event stores. They go to
+// metrics.Default, so call metrics.SetDefault before using a store to see
+// them.
+
+// CountEventsAppended counts events written for an aggregate type.
+func CountEventsAppended(aggregateType string, n int) {
+	metrics.Default().Counter("conqueress_events_appended_total",
+		"Events appended to the event store.", "aggregate_type").Add(float64(n), aggregateType)
+}
+
+// CountEventsRead counts events read back for an aggregate type.
+func CountEventsRead(aggregateType string, n int) {
+	metrics.Default().Counter("conqueress_events_read_total",
+		"Events read from the event store.", "aggregate_type").Add(float64(n), aggregateType)
+}
+
+// CountConcurrencyConflict counts a save rejected because the aggregate had
+// moved past the expected version. Event stores call it when they detect one.
+func CountConcurrencyConflict(aggregateType string) {
+	metrics.Default().Counter("conqueress_concurrency_conflicts_total",
+		"Saves rejected because the aggregate was changed concurrently.", "aggregate_type").Add(1, aggregateType)
+}
+
+// ObserveTransaction records how long a store took over one operation,
+// such as a save transaction, since started.
+func ObserveTransaction(store, operation string, started time.Time) {
+	metrics.Default().Histogram("conqueress_store_transaction_duration_seconds",
+		"Time taken by event store operations.", "store", "operation").Observe(time.Since(started).Seconds(), store, operation)
+}
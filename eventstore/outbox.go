@@ -0,0 +1,211 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/iamkoch/conqueress"
+)
+
+const (
+	defaultOutboxPollInterval = time.Second
+	outboxBatchSize           = 100
+	outboxLease               = time.Minute
+)
+
+// OutboxEntry is an event waiting in an outbox to be published. Attempts
+// counts how many times it has been claimed for publishing.
+type OutboxEntry struct {
+	Id       string
+	Event    conqueress.Event
+	Attempts int
+}
+
+// Outbox holds the events an event store has saved until they are published.
+// Stores that keep one write an entry for each event in the same transaction
+// as the event, so an event is never saved without being published, however
+// the process fails afterwards.
+//
+// Claim claims up to limit entries that have not been dispatched, in the
+// order their events were saved, starting from the oldest. It stops at the
+// first entry that is still leased, even when entries behind it are not, so
+// no entry is published ahead of an older one that has not been dispatched.
+// When it fails part way, it returns the entries it has claimed along with
+// the error. Entries whose event cannot be decoded should be set aside rather
+// than fail the claim, so they do not hold back the rest. Claiming leases an
+// entry until now plus lease, so no other relay receives it in the meantime,
+// and it is claimed again if MarkDispatched is not called before the lease
+// runs out.
+type Outbox interface {
+	Claim(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]OutboxEntry, error)
+	MarkDispatched(ctx context.Context, id string) error
+}
+
+// OutboxRelay publishes the events in an outbox. Delivery is at least once:
+// an event whose publishing fails, or that was published just before the
+// relay stopped, is published again, so processors must tolerate
+// duplicates. Events are published in the order they were saved, however
+// many relays run against the outbox, because an outbox does not claim past
+// an entry another relay holds.
+type OutboxRelay struct {
+	outbox       Outbox
+	publisher    conqueress.EventPublisher
+	pollInterval time.Duration
+}
+
+// NewOutboxRelay returns a relay that publishes the events in outbox through
+// publisher, such as a conqueress.Mediator, checking for new ones every
+// pollInterval, or every second if pollInterval is not positive.
+func NewOutboxRelay(outbox Outbox, publisher conqueress.EventPublisher, pollInterval time.Duration) *OutboxRelay {
+	if pollInterval <= 0 {
+		pollInterval = defaultOutboxPollInterval
+	}
+	return &OutboxRelay{outbox, publisher, pollInterval}
+}
+
+// Run relays events until ctx is done. Entries left undispatched by a relay
+// that stopped, or crashed, are claimed again once their lease runs out.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.RelayPending(ctx); err != nil && ctx.Err() == nil {
+			slog.With(
+				"error", err,
+			).Error("Failed to relay outbox")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending publishes the events waiting in the outbox, one batch at a
+// time, until there are none left or one fails. It returns how many it
+// published. The failed event stays leased, and so holds back the events
+// behind it, until its lease runs out and it is claimed and retried first.
+func (r *OutboxRelay) RelayPending(ctx context.Context) (int, error) {
+	published := 0
+	for {
+		// An outbox that fails part way returns the entries it has claimed,
+		// which are published before the failure is reported.
+		entries, claimErr := r.outbox.Claim(ctx, time.Now().UTC(), outboxBatchSize, outboxLease)
+		if len(entries) == 0 {
+			return published, claimErr
+		}
+
+		for _, entry := range entries {
+			if err := r.publish(ctx, entry.Event); err != nil {
+				slog.With(
+					"id", entry.Id,
+					"type", reflect.TypeOf(entry.Event),
+					"attempts", entry.Attempts,
+					"error", err,
+				).Warn("Failed to publish event from outbox")
+				return published, err
+			}
+			if err := r.outbox.MarkDispatched(ctx, entry.Id); err != nil {
+				return published, err
+			}
+			published++
+		}
+		if claimErr != nil {
+			return published, claimErr
+		}
+	}
+}
+
+// publish publishes evt synchronously, so it is only marked dispatched once
+// its processors have run. An event nothing processes counts as published.
+func (r *OutboxRelay) publish(ctx context.Context, evt conqueress.Event) error {
+	var err error
+	if cp, ok := r.publisher.(conqueress.ContextEventPublisher); ok {
+		err = cp.PublishSyncContext(ctx, evt)
+	} else {
+		err = r.publisher.PublishSync(evt)
+	}
+	if errors.Is(err, conqueress.ErrNoProcessor) {
+		return nil
+	}
+	return err
+}
+
+type inMemoryOutboxEntry struct {
+	OutboxEntry
+	leaseUntil time.Time
+	dispatched bool
+}
+
+// InMemoryOutbox keeps outbox entries in memory, for testing code that relays
+// an outbox. It is safe for concurrent use.
+type InMemoryOutbox struct {
+	mu      sync.Mutex
+	entries []*inMemoryOutboxEntry
+}
+
+func NewInMemoryOutbox() *InMemoryOutbox {
+	return &InMemoryOutbox{}
+}
+
+// Add puts evt in the outbox, after the events already in it.
+func (o *InMemoryOutbox) Add(evt conqueress.Event) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.entries = append(o.entries, &inMemoryOutboxEntry{
+		OutboxEntry: OutboxEntry{Id: evt.MsgId().String(), Event: evt},
+	})
+}
+
+func (o *InMemoryOutbox) Claim(_ context.Context, now time.Time, limit int, lease time.Duration) ([]OutboxEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	claimed := make([]OutboxEntry, 0)
+	for _, e := range o.entries {
+		if len(claimed) == limit {
+			break
+		}
+		if e.dispatched {
+			continue
+		}
+		if e.leaseUntil.After(now) {
+			break
+		}
+		e.Attempts++
+		e.leaseUntil = now.Add(lease)
+		claimed = append(claimed, e.OutboxEntry)
+	}
+	return claimed, nil
+}
+
+func (o *InMemoryOutbox) MarkDispatched(_ context.Context, id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, e := range o.entries {
+		if e.Id == id {
+			e.dispatched = true
+		}
+	}
+	return nil
+}
+
+// Pending returns the entries that have not been dispatched yet, in order.
+func (o *InMemoryOutbox) Pending() []OutboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	pending := make([]OutboxEntry, 0)
+	for _, e := range o.entries {
+		if !e.dispatched {
+			pending = append(pending, e.OutboxEntry)
+		}
+	}
+	return pending
+}
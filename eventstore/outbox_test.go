@@ -0,0 +1,164 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iamkoch/conqueress"
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type parcelSent struct {
+	*conqueress.BaseEvent
+	Parcel string
+}
+
+func TestOutboxRelay(t *testing.T) {
+	var (
+		mediator  *conqueress.Mediator
+		outbox    *InMemoryOutbox
+		relay     *OutboxRelay
+		delivered []string
+		published int
+		err       error
+	)
+	setup := func(fail string) {
+		mediator = conqueress.NewMediator(false)
+		outbox = NewInMemoryOutbox()
+		relay = NewOutboxRelay(outbox, mediator, 0)
+		delivered = nil
+		_, _ = conqueress.Subscribe(mediator, func(ctx context.Context, evt parcelSent) error {
+			if evt.Parcel == fail {
+				return errors.New("courier unavailable")
+			}
+			delivered = append(delivered, evt.Parcel)
+			return nil
+		})
+		for _, parcel := range []string{"first", "second", "third"} {
+			outbox.Add(conqueress.NewEvent[parcelSent](func(e *parcelSent) { e.Parcel = parcel }))
+		}
+	}
+
+	ensure.That("the relay publishes waiting events in order and marks them dispatched", func(s *ensure.Scenario) {
+		s.Given("an outbox with three events", func() {
+			setup("")
+		})
+
+		s.When("the relay runs", func() {
+			published, err = relay.RelayPending(context.Background())
+		})
+
+		s.Then("every event should be published in order", func() {
+			require.Nil(t, err)
+			assert.Equal(t, 3, published)
+			assert.Equal(t, []string{"first", "second", "third"}, delivered)
+		})
+
+		s.And("none should be left waiting", func() {
+			assert.Empty(t, outbox.Pending())
+		})
+	}, t)
+
+	ensure.That("the relay stops at an event it fails to publish and leaves it waiting", func(s *ensure.Scenario) {
+		s.Given("an outbox whose second event cannot be processed", func() {
+			setup("second")
+		})
+
+		s.When("the relay runs", func() {
+			published, err = relay.RelayPending(context.Background())
+		})
+
+		s.Then("only the events before it should be published", func() {
+			require.NotNil(t, err)
+			assert.Equal(t, 1, published)
+			assert.Equal(t, []string{"first"}, delivered)
+		})
+
+		s.And("it and the events after it should still be waiting", func() {
+			assert.Len(t, outbox.Pending(), 2)
+		})
+	}, t)
+
+	ensure.That("events saved after a failed one are not published ahead of it", func(s *ensure.Scenario) {
+		s.Given("an outbox whose second event failed to publish", func() {
+			setup("second")
+			_, err = relay.RelayPending(context.Background())
+			require.NotNil(t, err)
+		})
+
+		s.When("another event is saved and the relay runs again within the lease", func() {
+			outbox.Add(conqueress.NewEvent[parcelSent](func(e *parcelSent) { e.Parcel = "fourth" }))
+			published, err = relay.RelayPending(context.Background())
+		})
+
+		s.Then("nothing should be published", func() {
+			require.Nil(t, err)
+			assert.Equal(t, 0, published)
+			assert.Equal(t, []string{"first"}, delivered)
+		})
+
+		s.And("the failed event should be claimed first once its lease runs out", func() {
+			claimed, err := outbox.Claim(context.Background(), time.Now().Add(2*outboxLease), 10, outboxLease)
+			require.Nil(t, err)
+			var parcels []string
+			for _, c := range claimed {
+				parcels = append(parcels, c.Event.(parcelSent).Parcel)
+			}
+			assert.Equal(t, []string{"second", "third", "fourth"}, parcels)
+		})
+	}, t)
+}
+
+// failingOutbox claims the entries of an InMemoryOutbox and then fails, as an
+// outbox that fails part way through a claim does.
+type failingOutbox struct {
+	*InMemoryOutbox
+	failures int
+}
+
+func (o *failingOutbox) Claim(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]OutboxEntry, error) {
+	entries, _ := o.InMemoryOutbox.Claim(ctx, now, limit, lease)
+	if o.failures > 0 {
+		o.failures--
+		return entries, errors.New("connection reset")
+	}
+	return entries, nil
+}
+
+func TestOutboxRelayPartialClaim(t *testing.T) {
+	var (
+		mediator  *conqueress.Mediator
+		outbox    *failingOutbox
+		delivered []string
+		published int
+		err       error
+	)
+	ensure.That("entries claimed before a claim fails are still published", func(s *ensure.Scenario) {
+		s.Given("an outbox that fails after claiming two events", func() {
+			mediator = conqueress.NewMediator(false)
+			outbox = &failingOutbox{NewInMemoryOutbox(), 1}
+			_, _ = conqueress.Subscribe(mediator, func(ctx context.Context, evt parcelSent) error {
+				delivered = append(delivered, evt.Parcel)
+				return nil
+			})
+			for _, parcel := range []string{"first", "second"} {
+				outbox.Add(conqueress.NewEvent[parcelSent](func(e *parcelSent) { e.Parcel = parcel }))
+			}
+		})
+
+		s.When("the relay runs", func() {
+			published, err = NewOutboxRelay(outbox, mediator, 0).RelayPending(context.Background())
+		})
+
+		s.Then("both events should be published before the failure is reported", func() {
+			assert.NotNil(t, err)
+			assert.Equal(t, 2, published)
+			assert.Equal(t, []string{"first", "second"}, delivered)
+			assert.Empty(t, outbox.Pending())
+		})
+	}, t)
+}
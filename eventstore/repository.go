@@ -1,10 +1,16 @@
 package eventstore
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/iamkoch/conqueress"
 	"github.com/iamkoch/conqueress/domain"
 	"github.com/iamkoch/conqueress/guid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"reflect"
 )
 
@@ -22,14 +28,58 @@ type IGenericIDEventStore[TID any] interface {
 	GetEventsForAggregate(aggregateId TID) []conqueress.Event
 }
 
+// IContextEventStore is implemented by event stores whose calls also take a
+// context, which carries cancellation and the trace the call belongs to.
+// Repositories use these methods when the store has them. Every store in this
+// module does.
+type IContextEventStore[TID any] interface {
+	SaveEventsContext(ctx context.Context, aggregateType string, aggregateId TID, events []conqueress.Event, expectedVersion int) error
+	GetEventsForAggregateContext(ctx context.Context, aggregateId TID) []conqueress.Event
+}
+
+// IVersionRangeEventStore is implemented by event stores that can read part
+// of an aggregate's stream, so a long-lived aggregate can be loaded from a
+// known version rather than replayed from its first event. Versions start at
+// 0 with the first event. GetEventsForAggregateFrom returns the events from
+// fromVersion on, and GetEventsForAggregateRange those from fromVersion to
+// toVersion, both inclusive and in version order. Every store in this module
+// implements it.
+type IVersionRangeEventStore[TID any] interface {
+	GetEventsForAggregateFrom(ctx context.Context, aggregateId TID, fromVersion int) ([]conqueress.Event, error)
+	GetEventsForAggregateRange(ctx context.Context, aggregateId TID, fromVersion, toVersion int) ([]conqueress.Event, error)
+}
+
 type Repository[T domain.IAggregate] interface {
 	GetById(id guid.Guid) (T, error)
 	Save(aggregate T, expectedVersion int) error
+	GetByIdContext(ctx context.Context, id guid.Guid) (T, error)
+	SaveContext(ctx context.Context, aggregate T, expectedVersion int) error
 }
 
 type GenericIDRepository[T domain.IGenericIDAggregate[TID], TID any] interface {
 	GetById(id TID) (T, error)
 	Save(aggregate T, expectedVersion int) error
+	GetByIdContext(ctx context.Context, id TID) (T, error)
+	SaveContext(ctx context.Context, aggregate T, expectedVersion int) error
+}
+
+var tracer = otel.Tracer("github.com/iamkoch/conqueress/eventstore")
+
+// Span attributes recorded by the repositories and the event stores.
+const (
+	AggregateIdKey   = attribute.Key("conqueress.aggregate.id")
+	AggregateTypeKey = attribute.Key("conqueress.aggregate.type")
+	EventCountKey    = attribute.Key("conqueress.event.count")
+)
+
+// EndSpan records err on span, if there is one, and ends it. Event stores use
+// it to end the spans they record.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
 }
 
 var (
@@ -47,12 +97,20 @@ type genericIDRepository[T domain.IGenericIDAggregate[TID], TID any] struct {
 }
 
 func (g genericRepository[T]) GetById(id guid.Guid) (T, error) {
-	events := g.store.GetEventsForAggregate(id)
+	return g.GetByIdContext(context.Background(), id)
+}
+
+func (g genericRepository[T]) GetByIdContext(ctx context.Context, id guid.Guid) (agg T, err error) {
+	ctx, span := startRepositorySpan(ctx, "GetById", agg, id)
+	defer func() { EndSpan(span, err) }()
+
+	events := getEvents[guid.Guid](ctx, g.store, id)
+	CountEventsRead(aggregateTypeName(agg), len(events))
 	if len(events) == 0 {
 		var t T
 		return t, ErrAggregateNotFound
 	}
-	agg := g.createInstance()
+	agg = g.createInstance()
 	for _, e := range events {
 		reflect.ValueOf(agg).Interface().(domain.InnerApplier).InnerApply(e)
 	}
@@ -60,22 +118,39 @@ func (g genericRepository[T]) GetById(id guid.Guid) (T, error) {
 }
 
 func (g genericRepository[T]) Save(aggregate T, expectedVersion int) error {
-	e := g.store.SaveEvents(
-		reflect.TypeOf(aggregate).Name(),
+	return g.SaveContext(context.Background(), aggregate, expectedVersion)
+}
+
+func (g genericRepository[T]) SaveContext(ctx context.Context, aggregate T, expectedVersion int) (err error) {
+	ctx, span := startRepositorySpan(ctx, "Save", aggregate, aggregate.Id())
+	defer func() { EndSpan(span, err) }()
+
+	err = saveEvents[guid.Guid](ctx, g.store,
+		aggregateTypeName(aggregate),
 		aggregate.Id(),
 		aggregate.UncommittedEvents(),
 		expectedVersion)
-
-	return e
+	if err == nil {
+		CountEventsAppended(aggregateTypeName(aggregate), len(aggregate.UncommittedEvents()))
+	}
+	return err
 }
 
 func (g genericIDRepository[T, TID]) GetById(id TID) (T, error) {
-	events := g.store.GetEventsForAggregate(id)
+	return g.GetByIdContext(context.Background(), id)
+}
+
+func (g genericIDRepository[T, TID]) GetByIdContext(ctx context.Context, id TID) (agg T, err error) {
+	ctx, span := startRepositorySpan(ctx, "GetById", agg, id)
+	defer func() { EndSpan(span, err) }()
+
+	events := getEvents[TID](ctx, g.store, id)
+	CountEventsRead(aggregateTypeName(agg), len(events))
 	if len(events) == 0 {
 		var t T
 		return t, ErrAggregateNotFound
 	}
-	agg := g.createInstance()
+	agg = g.createInstance()
 	for _, e := range events {
 		reflect.ValueOf(agg).Interface().(domain.InnerApplier).InnerApply(e)
 	}
@@ -83,13 +158,64 @@ func (g genericIDRepository[T, TID]) GetById(id TID) (T, error) {
 }
 
 func (g genericIDRepository[T, TID]) Save(aggregate T, expectedVersion int) error {
-	e := g.store.SaveEvents(
-		reflect.TypeOf(aggregate).Name(),
+	return g.SaveContext(context.Background(), aggregate, expectedVersion)
+}
+
+func (g genericIDRepository[T, TID]) SaveContext(ctx context.Context, aggregate T, expectedVersion int) (err error) {
+	ctx, span := startRepositorySpan(ctx, "Save", aggregate, aggregate.Id())
+	defer func() { EndSpan(span, err) }()
+
+	err = saveEvents[TID](ctx, g.store,
+		aggregateTypeName(aggregate),
 		aggregate.Id(),
 		aggregate.UncommittedEvents(),
 		expectedVersion)
+	if err == nil {
+		CountEventsAppended(aggregateTypeName(aggregate), len(aggregate.UncommittedEvents()))
+	}
+	return err
+}
 
-	return e
+func startRepositorySpan(ctx context.Context, operation string, aggregate any, id any) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "Repository."+operation, trace.WithAttributes(
+		AggregateTypeKey.String(aggregateTypeName(aggregate)),
+		AggregateIdKey.String(fmt.Sprint(id)),
+	))
+}
+
+// aggregateTypeName names the aggregate's type for spans and metrics, looking
+// through a pointer.
+func aggregateTypeName(aggregate any) string {
+	aggregateType := reflect.TypeOf(aggregate)
+	if aggregateType.Kind() == reflect.Pointer {
+		aggregateType = aggregateType.Elem()
+	}
+	return aggregateType.Name()
+}
+
+// getEvents and saveEvents call the store's context-aware methods when it
+// has them. The event store interfaces are satisfied by the same stores for
+// any ID type, so store is passed as an any.
+func getEvents[TID any](ctx context.Context, store any, id TID) []conqueress.Event {
+	if cs, ok := store.(IContextEventStore[TID]); ok {
+		return cs.GetEventsForAggregateContext(ctx, id)
+	}
+	return store.(IGenericIDEventStore[TID]).GetEventsForAggregate(id)
+}
+
+// saveEvents also records the current span, the correlation and causation
+// IDs, and the user and tenant, on each event, so processors that receive
+// the event later can link back to the command that raised it.
+func saveEvents[TID any](ctx context.Context, store any, aggregateType string, id TID, events []conqueress.Event, expectedVersion int) error {
+	for _, e := range events {
+		conqueress.InjectTraceContext(ctx, e)
+		conqueress.InjectCorrelation(ctx, e)
+		conqueress.InjectIdentity(ctx, e)
+	}
+	if cs, ok := store.(IContextEventStore[TID]); ok {
+		return cs.SaveEventsContext(ctx, aggregateType, id, events, expectedVersion)
+	}
+	return store.(IGenericIDEventStore[TID]).SaveEvents(aggregateType, id, events, expectedVersion)
 }
 
 func NewRepository[T domain.IAggregate](
@@ -103,3 +229,25 @@ func NewGenericIDRepository[T domain.IGenericIDAggregate[TID], TID any](
 	createInstance func() T) GenericIDRepository[T, TID] {
 	return genericIDRepository[T, TID]{store, createInstance}
 }
+
+// SaveWithResult saves the aggregate's uncommitted events like
+// Repository.SaveContext and describes the write as a
+// conqueress.CommandResult, so a command handler can return it from
+// DispatchFor. The version and position are the ones the store assigned to
+// the last event written. The position is zero when the store does not
+// record one on the event.
+func SaveWithResult[T domain.IAggregate](ctx context.Context, repo Repository[T], aggregate T, expectedVersion int) (conqueress.CommandResult, error) {
+	if err := repo.SaveContext(ctx, aggregate, expectedVersion); err != nil {
+		return conqueress.CommandResult{}, err
+	}
+	result := conqueress.CommandResult{
+		AggregateId: aggregate.Id().String(),
+		Version:     expectedVersion,
+	}
+	if events := aggregate.UncommittedEvents(); len(events) > 0 {
+		last := events[len(events)-1]
+		result.Version = last.Version()
+		result.Position = conqueress.MetadataOf(last).Position
+	}
+	return result, nil
+}
@@ -0,0 +1,97 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const defaultSnapshotEvery = 100
+
+var (
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+)
+
+// Snapshot is an aggregate's state as of the event at Version. Schema is the
+// aggregate's SnapshotSchema when the snapshot was taken.
+type Snapshot struct {
+	AggregateId   string
+	AggregateType string
+	Version       int
+	Schema        int
+	Data          []byte
+	TakenAt       time.Time
+}
+
+// SnapshotStore keeps snapshots keyed by aggregate ID and version.
+// LatestSnapshot returns the snapshot with the highest version for the
+// aggregate, or ErrSnapshotNotFound when there is none.
+type SnapshotStore interface {
+	SaveSnapshot(ctx context.Context, snapshot Snapshot) error
+	LatestSnapshot(ctx context.Context, aggregateId string) (Snapshot, error)
+}
+
+// SnapshotPolicy decides, after an aggregate is saved, whether to snapshot
+// it. eventsSince is the number of the aggregate's events after the latest
+// snapshot, and latest is that snapshot, which is zero when there is none. A
+// snapshot taken with another schema than the aggregate's counts as none.
+type SnapshotPolicy func(eventsSince int, latest Snapshot) bool
+
+// EveryNEvents snapshots an aggregate once n events have been saved since its
+// latest snapshot.
+func EveryNEvents(n int) SnapshotPolicy {
+	return func(eventsSince int, _ Snapshot) bool {
+		return eventsSince >= n
+	}
+}
+
+// EveryInterval snapshots an aggregate when it is saved and its latest
+// snapshot is older than d, or it has none.
+func EveryInterval(d time.Duration) SnapshotPolicy {
+	return func(eventsSince int, latest Snapshot) bool {
+		return eventsSince > 0 && time.Since(latest.TakenAt) >= d
+	}
+}
+
+// AnyPolicy snapshots an aggregate when any of policies would.
+func AnyPolicy(policies ...SnapshotPolicy) SnapshotPolicy {
+	return func(eventsSince int, latest Snapshot) bool {
+		for _, p := range policies {
+			if p(eventsSince, latest) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// InMemorySnapshotStore keeps snapshots in memory. It is safe for concurrent
+// use.
+type InMemorySnapshotStore struct {
+	mu        sync.Mutex
+	snapshots map[string]Snapshot
+}
+
+func NewInMemorySnapshotStore() *InMemorySnapshotStore {
+	return &InMemorySnapshotStore{snapshots: make(map[string]Snapshot)}
+}
+
+func (s *InMemorySnapshotStore) SaveSnapshot(_ context.Context, snapshot Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if latest, ok := s.snapshots[snapshot.AggregateId]; !ok || snapshot.Version >= latest.Version {
+		s.snapshots[snapshot.AggregateId] = snapshot
+	}
+	return nil
+}
+
+func (s *InMemorySnapshotStore) LatestSnapshot(_ context.Context, aggregateId string) (Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot, ok := s.snapshots[aggregateId]
+	if !ok {
+		return Snapshot{}, ErrSnapshotNotFound
+	}
+	return snapshot, nil
+}
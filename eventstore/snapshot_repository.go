@@ -0,0 +1,286 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/iamkoch/conqueress"
+	"github.com/iamkoch/conqueress/domain"
+	"github.com/iamkoch/conqueress/guid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SnapshotOption configures a repository created by NewSnapshotRepository or
+// NewGenericIDSnapshotRepository.
+type SnapshotOption func(*snapshotRepositoryConfig)
+
+type snapshotRepositoryConfig struct {
+	policy SnapshotPolicy
+}
+
+// WithSnapshotPolicy sets when the repository snapshots an aggregate it has
+// saved. The default is EveryNEvents(100).
+func WithSnapshotPolicy(p SnapshotPolicy) SnapshotOption {
+	return func(c *snapshotRepositoryConfig) {
+		c.policy = p
+	}
+}
+
+type snapshotRepository[T domain.IGenericIDAggregate[TID], TID any] struct {
+	store          any
+	snapshots      SnapshotStore
+	createInstance func() T
+	policy         SnapshotPolicy
+	latest         *latestSnapshots
+}
+
+// latestSnapshotsSize is how many aggregates a repository remembers the
+// latest snapshot of.
+const latestSnapshotsSize = 10000
+
+// latestSnapshots remembers the latest snapshot of each aggregate a
+// repository has loaded or snapshotted, without its data, so saving the
+// aggregate does not read the snapshot back from the store. A nil snapshot
+// means the aggregate had none. Another process may have snapshotted an
+// aggregate since, which only means the policy sees more events since its
+// latest snapshot than there are. It is safe for concurrent use.
+type latestSnapshots struct {
+	mu        sync.Mutex
+	snapshots map[string]*Snapshot
+}
+
+func (l *latestSnapshots) get(id string) (*Snapshot, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.snapshots[id]
+	return s, ok
+}
+
+// put remembers snapshot as the latest of the aggregate, forgetting every
+// other aggregate when there are already latestSnapshotsSize of them.
+func (l *latestSnapshots) put(id string, snapshot *Snapshot) {
+	if snapshot != nil {
+		header := *snapshot
+		header.Data = nil
+		snapshot = &header
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.snapshots[id]; !ok && len(l.snapshots) >= latestSnapshotsSize {
+		l.snapshots = make(map[string]*Snapshot)
+	}
+	l.snapshots[id] = snapshot
+}
+
+// NewSnapshotRepository returns a repository that snapshots aggregates which
+// implement domain.Snapshotter into snapshots, as policy decides after each
+// save. GetById restores the newest snapshot and replays only the events
+// saved after it, reading them from the version the snapshot was taken at
+// when the store implements IVersionRangeEventStore. It replays every event
+// instead when there is no snapshot, when the snapshot's schema is not the
+// aggregate's SnapshotSchema, or when restoring it fails. The repository
+// remembers the newest snapshot of the aggregates it loads and snapshots, so
+// saving one it has loaded does not read the snapshot again.
+//
+// A restored aggregate has its ID set with SetId, and its version with
+// SetVersion, when it has those methods, as aggregates that embed
+// domain.AggregateRootBase do. Aggregates that are not Snapshotters are
+// loaded and saved as NewRepository would.
+func NewSnapshotRepository[T domain.IAggregate](
+	store IEventStore,
+	snapshots SnapshotStore,
+	createInstance func() T,
+	opts ...SnapshotOption) Repository[T] {
+	return newSnapshotRepository[T, guid.Guid](store, snapshots, createInstance, opts)
+}
+
+// NewGenericIDSnapshotRepository is NewSnapshotRepository for aggregates
+// whose ID is not a guid.Guid.
+func NewGenericIDSnapshotRepository[T domain.IGenericIDAggregate[TID], TID any](
+	store IGenericIDEventStore[TID],
+	snapshots SnapshotStore,
+	createInstance func() T,
+	opts ...SnapshotOption) GenericIDRepository[T, TID] {
+	return newSnapshotRepository[T, TID](store, snapshots, createInstance, opts)
+}
+
+func newSnapshotRepository[T domain.IGenericIDAggregate[TID], TID any](store any, snapshots SnapshotStore, createInstance func() T, opts []SnapshotOption) snapshotRepository[T, TID] {
+	c := snapshotRepositoryConfig{policy: EveryNEvents(defaultSnapshotEvery)}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return snapshotRepository[T, TID]{store, snapshots, createInstance, c.policy,
+		&latestSnapshots{snapshots: make(map[string]*Snapshot)}}
+}
+
+func (r snapshotRepository[T, TID]) GetById(id TID) (T, error) {
+	return r.GetByIdContext(context.Background(), id)
+}
+
+func (r snapshotRepository[T, TID]) GetByIdContext(ctx context.Context, id TID) (agg T, err error) {
+	ctx, span := startRepositorySpan(ctx, "GetById", agg, id)
+	defer func() { EndSpan(span, err) }()
+
+	if restored, snapshot, ok := r.restore(ctx, id); ok {
+		events, err := getEventsFrom[TID](ctx, r.store, id, snapshot.Version+1)
+		if err != nil {
+			var t T
+			return t, err
+		}
+		CountEventsRead(aggregateTypeName(restored), len(events))
+		applyEvents(restored, events)
+		return restored, nil
+	}
+
+	events := getEvents[TID](ctx, r.store, id)
+	CountEventsRead(aggregateTypeName(agg), len(events))
+	if len(events) == 0 {
+		var t T
+		return t, ErrAggregateNotFound
+	}
+	agg = r.createInstance()
+	applyEvents(agg, events)
+	return agg, nil
+}
+
+// restore returns a fresh aggregate with the newest usable snapshot of it
+// restored, and that snapshot, or false if there is none. Failures to read
+// or restore the snapshot are recorded on the span in ctx, and the aggregate
+// is replayed instead.
+func (r snapshotRepository[T, TID]) restore(ctx context.Context, id TID) (T, Snapshot, bool) {
+	var none T
+	agg := r.createInstance()
+	s, ok := any(agg).(domain.Snapshotter)
+	if !ok {
+		return none, Snapshot{}, false
+	}
+
+	key := fmt.Sprint(id)
+	snapshot, err := r.snapshots.LatestSnapshot(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrSnapshotNotFound) {
+			r.latest.put(key, nil)
+		} else {
+			trace.SpanFromContext(ctx).RecordError(err)
+		}
+		return none, Snapshot{}, false
+	}
+	r.latest.put(key, &snapshot)
+	if snapshot.Schema != s.SnapshotSchema() {
+		return none, Snapshot{}, false
+	}
+	if err = s.RestoreSnapshot(snapshot.Data); err != nil {
+		trace.SpanFromContext(ctx).RecordError(err)
+		return none, Snapshot{}, false
+	}
+
+	if setter, ok := any(agg).(interface{ SetId(TID) }); ok {
+		setter.SetId(id)
+	}
+	if setter, ok := any(agg).(interface{ SetVersion(int) }); ok {
+		setter.SetVersion(snapshot.Version)
+	}
+	return agg, snapshot, true
+}
+
+func (r snapshotRepository[T, TID]) Save(aggregate T, expectedVersion int) error {
+	return r.SaveContext(context.Background(), aggregate, expectedVersion)
+}
+
+func (r snapshotRepository[T, TID]) SaveContext(ctx context.Context, aggregate T, expectedVersion int) (err error) {
+	ctx, span := startRepositorySpan(ctx, "Save", aggregate, aggregate.Id())
+	defer func() { EndSpan(span, err) }()
+
+	err = saveEvents[TID](ctx, r.store,
+		aggregateTypeName(aggregate),
+		aggregate.Id(),
+		aggregate.UncommittedEvents(),
+		expectedVersion)
+	if err != nil {
+		return err
+	}
+	CountEventsAppended(aggregateTypeName(aggregate), len(aggregate.UncommittedEvents()))
+	r.snapshot(ctx, aggregate)
+	return nil
+}
+
+// snapshot snapshots the aggregate just saved if the policy asks for it. The
+// latest snapshot is only read from the store when the repository does not
+// remember it. A latest snapshot with a stale schema cannot be restored, so
+// the policy is asked as if there were none. The events are already saved,
+// so a failure is recorded on the span in ctx rather than failing the save.
+func (r snapshotRepository[T, TID]) snapshot(ctx context.Context, aggregate T) {
+	s, ok := any(aggregate).(domain.Snapshotter)
+	events := aggregate.UncommittedEvents()
+	if !ok || len(events) == 0 {
+		return
+	}
+
+	id := fmt.Sprint(aggregate.Id())
+	version := events[len(events)-1].Version()
+	stored, ok := r.latest.get(id)
+	if !ok {
+		snapshot, err := r.snapshots.LatestSnapshot(ctx, id)
+		switch {
+		case err == nil:
+			stored = &snapshot
+		case !errors.Is(err, ErrSnapshotNotFound):
+			trace.SpanFromContext(ctx).RecordError(err)
+			return
+		}
+		r.latest.put(id, stored)
+	}
+
+	eventsSince := version + 1
+	var latest Snapshot
+	if stored != nil && stored.Schema == s.SnapshotSchema() {
+		eventsSince = version - stored.Version
+		latest = *stored
+	}
+	if !r.policy(eventsSince, latest) {
+		return
+	}
+
+	data, err := s.Snapshot()
+	if err != nil {
+		trace.SpanFromContext(ctx).RecordError(err)
+		return
+	}
+	snapshot := Snapshot{
+		AggregateId:   id,
+		AggregateType: aggregateTypeName(aggregate),
+		Version:       version,
+		Schema:        s.SnapshotSchema(),
+		Data:          data,
+		TakenAt:       time.Now().UTC(),
+	}
+	if err = r.snapshots.SaveSnapshot(ctx, snapshot); err != nil {
+		trace.SpanFromContext(ctx).RecordError(err)
+		return
+	}
+	r.latest.put(id, &snapshot)
+}
+
+// getEventsFrom reads the aggregate's events from fromVersion on, with the
+// store's range read when it has one.
+func getEventsFrom[TID any](ctx context.Context, store any, id TID, fromVersion int) ([]conqueress.Event, error) {
+	if vs, ok := store.(IVersionRangeEventStore[TID]); ok {
+		return vs.GetEventsForAggregateFrom(ctx, id, fromVersion)
+	}
+	events := make([]conqueress.Event, 0)
+	for _, e := range getEvents[TID](ctx, store, id) {
+		if e.Version() >= fromVersion {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func applyEvents(agg any, events []conqueress.Event) {
+	for _, e := range events {
+		agg.(domain.InnerApplier).InnerApply(e)
+	}
+}
@@ -0,0 +1,79 @@
+package eventstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotPolicies(t *testing.T) {
+	recent := Snapshot{Version: 10, TakenAt: time.Now()}
+	stale := Snapshot{Version: 10, TakenAt: time.Now().Add(-time.Hour)}
+
+	ensure.That("EveryNEvents snapshots once enough events have been saved", func(s *ensure.Scenario) {
+		policy := EveryNEvents(5)
+
+		s.Then("it should wait for the fifth event", func() {
+			assert.False(t, policy(4, recent))
+			assert.True(t, policy(5, recent))
+		})
+	}, t)
+
+	ensure.That("EveryInterval snapshots when the latest snapshot is old", func(s *ensure.Scenario) {
+		policy := EveryInterval(time.Minute)
+
+		s.Then("it should snapshot a stale aggregate or one without a snapshot", func() {
+			assert.False(t, policy(1, recent))
+			assert.True(t, policy(1, stale))
+			assert.True(t, policy(1, Snapshot{}))
+		})
+
+		s.And("it should not snapshot when nothing was saved", func() {
+			assert.False(t, policy(0, stale))
+		})
+	}, t)
+
+	ensure.That("AnyPolicy snapshots when any policy would", func(s *ensure.Scenario) {
+		policy := AnyPolicy(EveryNEvents(100), EveryInterval(time.Minute))
+
+		s.Then("either policy should be enough", func() {
+			assert.False(t, policy(1, recent))
+			assert.True(t, policy(1, stale))
+			assert.True(t, policy(100, recent))
+		})
+	}, t)
+}
+
+func TestInMemorySnapshotStore(t *testing.T) {
+	var (
+		store  *InMemorySnapshotStore
+		latest Snapshot
+		err    error
+	)
+	ensure.That("the latest snapshot is the one with the highest version", func(s *ensure.Scenario) {
+		s.Given("snapshots saved out of order", func() {
+			store = NewInMemorySnapshotStore()
+			for _, v := range []int{5, 9, 7} {
+				require.Nil(t, store.SaveSnapshot(context.Background(), Snapshot{AggregateId: "a", Version: v}))
+			}
+		})
+
+		s.When("I read the latest", func() {
+			latest, err = store.LatestSnapshot(context.Background(), "a")
+		})
+
+		s.Then("it should be at the highest version", func() {
+			require.Nil(t, err)
+			assert.Equal(t, 9, latest.Version)
+		})
+
+		s.And("an aggregate without snapshots should have none", func() {
+			_, err = store.LatestSnapshot(context.Background(), "b")
+			assert.ErrorIs(t, err, ErrSnapshotNotFound)
+		})
+	}, t)
+}
@@ -0,0 +1,48 @@
+package eventstore
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/iamkoch/conqueress"
+)
+
+// IStreamReader is implemented by event stores that can read a slice of
+// every event they hold, in order of global position, without reading the
+// rest. ReadAggregateType reads the events of every aggregate of one type,
+// under the name the repository saved them with. ReadEventTypes reads the
+// events whose type, as EventTypeName gives it, is one of eventTypes. Both
+// page as ReadAll does. Every store in this module implements it.
+type IStreamReader interface {
+	ReadAggregateType(ctx context.Context, aggregateType string, after int64, limit int) ([]PositionedEvent, error)
+	ReadEventTypes(ctx context.Context, eventTypes []string, after int64, limit int) ([]PositionedEvent, error)
+}
+
+// EventTypeName returns the name stores record evt's type under.
+func EventTypeName(evt conqueress.Event) string {
+	return reflect.TypeOf(evt).Name()
+}
+
+// AggregateTypeReader returns an IAllEventsReader over the events of every
+// aggregate of one type, so a Subscription can rebuild a projection of that
+// type without reading every other event.
+func AggregateTypeReader(r IStreamReader, aggregateType string) IAllEventsReader {
+	return readerFunc(func(ctx context.Context, after int64, limit int) ([]PositionedEvent, error) {
+		return r.ReadAggregateType(ctx, aggregateType, after, limit)
+	})
+}
+
+// EventTypesReader returns an IAllEventsReader over the events of the given
+// types, so a Subscription can rebuild a projection of those events without
+// reading every other event.
+func EventTypesReader(r IStreamReader, eventTypes ...string) IAllEventsReader {
+	return readerFunc(func(ctx context.Context, after int64, limit int) ([]PositionedEvent, error) {
+		return r.ReadEventTypes(ctx, eventTypes, after, limit)
+	})
+}
+
+type readerFunc func(ctx context.Context, after int64, limit int) ([]PositionedEvent, error)
+
+func (f readerFunc) ReadAll(ctx context.Context, after int64, limit int) ([]PositionedEvent, error) {
+	return f(ctx, after, limit)
+}
@@ -0,0 +1,197 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iamkoch/conqueress"
+)
+
+const (
+	defaultSubscriptionPollInterval = 500 * time.Millisecond
+	defaultSubscriptionBatchSize    = 100
+)
+
+// PositionedEvent is an event read from the store with its global position.
+type PositionedEvent struct {
+	Position int64
+	Event    conqueress.Event
+}
+
+// IAllEventsReader is implemented by event stores that can read every event
+// they hold in order of global position, whatever aggregate it belongs to.
+// ReadAll returns up to limit events whose position is after the given one,
+// lowest first. Positions only increase, but may have gaps. Every store in
+// this module implements it.
+type IAllEventsReader interface {
+	ReadAll(ctx context.Context, after int64, limit int) ([]PositionedEvent, error)
+}
+
+// CheckpointStore records how far each named subscription has got, so it can
+// resume where it left off. Load returns 0 for a subscription that has not
+// saved a checkpoint yet.
+type CheckpointStore interface {
+	Load(ctx context.Context, name string) (int64, error)
+	Save(ctx context.Context, name string, position int64) error
+}
+
+// SubscriptionHandler handles one event delivered by a Subscription.
+type SubscriptionHandler func(ctx context.Context, evt conqueress.Event) error
+
+// SubscriptionOption configures a Subscription created by NewSubscription.
+type SubscriptionOption func(*Subscription)
+
+// WithPollInterval sets how long a subscription that has caught up waits
+// before it checks for new events. The default is half a second.
+func WithPollInterval(d time.Duration) SubscriptionOption {
+	return func(s *Subscription) {
+		if d > 0 {
+			s.pollInterval = d
+		}
+	}
+}
+
+// WithBatchSize sets how many events a subscription reads at a time, and so
+// how often it saves its checkpoint. The default is 100.
+func WithBatchSize(n int) SubscriptionOption {
+	return func(s *Subscription) {
+		if n > 0 {
+			s.batchSize = n
+		}
+	}
+}
+
+// Subscription delivers every event in a store to a handler in order of
+// global position. It starts from its checkpoint, reads the events saved
+// since in batches until it has caught up, and then polls for new ones as
+// they are saved. It saves its checkpoint after each batch, so after a
+// restart it may deliver again the events of the batch it was in, and
+// handlers must tolerate duplicates.
+type Subscription struct {
+	name         string
+	reader       IAllEventsReader
+	checkpoints  CheckpointStore
+	handler      SubscriptionHandler
+	pollInterval time.Duration
+	batchSize    int
+
+	position   atomic.Int64
+	caughtUp   chan struct{}
+	markCaught sync.Once
+}
+
+// NewSubscription returns a subscription, identified in checkpoints by name,
+// that delivers the events reader holds to handler. It does nothing until Run
+// is called.
+func NewSubscription(name string, reader IAllEventsReader, checkpoints CheckpointStore, handler SubscriptionHandler, opts ...SubscriptionOption) *Subscription {
+	s := &Subscription{
+		name:         name,
+		reader:       reader,
+		checkpoints:  checkpoints,
+		handler:      handler,
+		pollInterval: defaultSubscriptionPollInterval,
+		batchSize:    defaultSubscriptionBatchSize,
+		caughtUp:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Run delivers events until ctx is done, when it returns nil, or until the
+// handler, the reader or the checkpoint store fails, when it returns the
+// error. The checkpoint is saved up to the last event handled, so running the
+// subscription again resumes at the event that failed.
+func (s *Subscription) Run(ctx context.Context) error {
+	position, err := s.checkpoints.Load(ctx, s.name)
+	if err != nil {
+		return err
+	}
+	s.position.Store(position)
+
+	for {
+		caughtUp, err := s.deliverBatch(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if !caughtUp {
+			continue
+		}
+
+		s.markCaught.Do(func() { close(s.caughtUp) })
+		timer := time.NewTimer(s.pollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// deliverBatch delivers the next batch of events and saves the checkpoint. It
+// reports whether the batch reached the end of the store.
+func (s *Subscription) deliverBatch(ctx context.Context) (bool, error) {
+	from := s.position.Load()
+	events, err := s.reader.ReadAll(ctx, from, s.batchSize)
+	if err != nil {
+		return false, err
+	}
+
+	var handlerErr error
+	for _, pe := range events {
+		if handlerErr = s.handler(ctx, pe.Event); handlerErr != nil {
+			break
+		}
+		s.position.Store(pe.Position)
+	}
+
+	if reached := s.position.Load(); reached != from {
+		if err := s.checkpoints.Save(ctx, s.name, reached); err != nil {
+			return false, errors.Join(handlerErr, err)
+		}
+	}
+	return len(events) < s.batchSize, handlerErr
+}
+
+// CaughtUp is closed once the subscription has delivered every event that
+// was in the store when it started, and has switched to waiting for new ones.
+func (s *Subscription) CaughtUp() <-chan struct{} {
+	return s.caughtUp
+}
+
+// Position returns the position of the last event the subscription handled.
+func (s *Subscription) Position() int64 {
+	return s.position.Load()
+}
+
+// InMemoryCheckpointStore keeps checkpoints in memory. It is safe for
+// concurrent use.
+type InMemoryCheckpointStore struct {
+	mu          sync.Mutex
+	checkpoints map[string]int64
+}
+
+func NewInMemoryCheckpointStore() *InMemoryCheckpointStore {
+	return &InMemoryCheckpointStore{checkpoints: make(map[string]int64)}
+}
+
+func (c *InMemoryCheckpointStore) Load(_ context.Context, name string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.checkpoints[name], nil
+}
+
+func (c *InMemoryCheckpointStore) Save(_ context.Context, name string, position int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkpoints[name] = position
+	return nil
+}
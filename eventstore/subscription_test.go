@@ -0,0 +1,125 @@
+package eventstore
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iamkoch/conqueress"
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sliceReader is an IAllEventsReader over events appended in position order.
+type sliceReader struct {
+	mu     sync.Mutex
+	events []PositionedEvent
+}
+
+func (r *sliceReader) add(parcel string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Leave a gap between positions, as the stores may.
+	r.events = append(r.events, PositionedEvent{
+		Position: int64(2*len(r.events) + 1),
+		Event:    conqueress.NewEvent[parcelSent](func(e *parcelSent) { e.Parcel = parcel }),
+	})
+}
+
+func (r *sliceReader) ReadAll(_ context.Context, after int64, limit int) ([]PositionedEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var events []PositionedEvent
+	for _, pe := range r.events {
+		if pe.Position > after && len(events) < limit {
+			events = append(events, pe)
+		}
+	}
+	return events, nil
+}
+
+func TestSubscription(t *testing.T) {
+	var (
+		reader      *sliceReader
+		checkpoints *InMemoryCheckpointStore
+		mu          sync.Mutex
+		delivered   []string
+	)
+	setup := func() {
+		reader = &sliceReader{}
+		checkpoints = NewInMemoryCheckpointStore()
+		delivered = nil
+		for _, parcel := range []string{"first", "second", "third"} {
+			reader.add(parcel)
+		}
+	}
+	handler := func(ctx context.Context, evt conqueress.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		delivered = append(delivered, evt.(parcelSent).Parcel)
+		return nil
+	}
+	run := func(sub *Subscription) (stop func()) {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- sub.Run(ctx) }()
+		return func() {
+			cancel()
+			require.Nil(t, <-done)
+		}
+	}
+	deliveredSoFar := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), delivered...)
+	}
+
+	ensure.That("a subscription catches up on history and then delivers new events", func(s *ensure.Scenario) {
+		var sub *Subscription
+		var stop func()
+
+		s.Given("a store with three events", func() {
+			setup()
+		})
+
+		s.When("a subscription runs until it has caught up and another event is saved", func() {
+			sub = NewSubscription("parcels", reader, checkpoints, handler, WithBatchSize(2), WithPollInterval(time.Millisecond))
+			stop = run(sub)
+			<-sub.CaughtUp()
+			reader.add("fourth")
+		})
+
+		s.Then("every event should be delivered in order", func() {
+			assert.Eventually(t, func() bool { return len(deliveredSoFar()) == 4 }, time.Second, time.Millisecond)
+			stop()
+			assert.Equal(t, []string{"first", "second", "third", "fourth"}, deliveredSoFar())
+		})
+
+		s.And("the checkpoint should be at the last event", func() {
+			position, err := checkpoints.Load(context.Background(), "parcels")
+			require.Nil(t, err)
+			assert.Equal(t, int64(7), position)
+			assert.Equal(t, int64(7), sub.Position())
+		})
+	}, t)
+
+	ensure.That("a subscription resumes from its checkpoint", func(s *ensure.Scenario) {
+		s.Given("a subscription that has handled the first two events", func() {
+			setup()
+			require.Nil(t, checkpoints.Save(context.Background(), "parcels", 3))
+		})
+
+		s.When("it runs again", func() {
+			sub := NewSubscription("parcels", reader, checkpoints, handler)
+			stop := run(sub)
+			<-sub.CaughtUp()
+			stop()
+		})
+
+		s.Then("only the events after the checkpoint should be delivered", func() {
+			assert.Equal(t, []string{"third"}, deliveredSoFar())
+		})
+	}, t)
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	cqrs "github.com/iamkoch/conqueress"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type dbProcessedCommand struct {
+	CommandId   string    `firestore:"command_id"`
+	CommandType string    `firestore:"command_type"`
+	Result      []byte    `firestore:"result"`
+	ProcessedAt time.Time `firestore:"processed_at"`
+	ExpiresAt   time.Time `firestore:"expires_at"`
+}
+
+type firestoreDeduplicationStore struct {
+	client *firestore.Client
+}
+
+// NewFirestoreDeduplicationStore returns a cqrs.DeduplicationStore that keeps
+// processed commands in the processed_commands collection, one document per
+// command type and ID. Get ignores expired records; to have Firestore delete them,
+// configure a TTL policy on the collection's expires_at field.
+func NewFirestoreDeduplicationStore(ctx context.Context) (cqrs.DeduplicationStore, error) {
+	client, err := firestore.NewClient(ctx, "iamkoch")
+
+	if err != nil {
+		fmt.Println("Error creating client ", err)
+		return nil, err
+	}
+
+	return firestoreDeduplicationStore{client}, nil
+}
+
+// processedCommandKey is the ID of the document recording a command. Type
+// names have no colons, so no two commands share one.
+func processedCommandKey(commandType, commandID string) string {
+	return commandType + ":" + commandID
+}
+
+func (f firestoreDeduplicationStore) Get(ctx context.Context, commandType, commandID string) (*cqrs.ProcessedCommand, error) {
+	doc, err := f.client.Collection("processed_commands").Doc(processedCommandKey(commandType, commandID)).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record dbProcessedCommand
+	if err = doc.DataTo(&record); err != nil {
+		return nil, err
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return nil, nil
+	}
+
+	return &cqrs.ProcessedCommand{
+		CommandID:   record.CommandId,
+		CommandType: record.CommandType,
+		Result:      record.Result,
+		ProcessedAt: record.ProcessedAt,
+		ExpiresAt:   record.ExpiresAt,
+	}, nil
+}
+
+func (f firestoreDeduplicationStore) Put(ctx context.Context, record cqrs.ProcessedCommand) error {
+	_, err := f.client.Collection("processed_commands").Doc(processedCommandKey(record.CommandType, record.CommandID)).Set(ctx, dbProcessedCommand{
+		CommandId:   record.CommandID,
+		CommandType: record.CommandType,
+		Result:      record.Result,
+		ProcessedAt: record.ProcessedAt,
+		ExpiresAt:   record.ExpiresAt,
+	})
+	return err
+}
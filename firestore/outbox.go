@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/iamkoch/conqueress/eventstore"
+)
+
+// dbOutboxEntry is an event in the outbox collection, whose document ID is
+// the event's ID. SaveEvents writes one for each event in the same
+// transaction as the event.
+type dbOutboxEntry struct {
+	dbEvent
+	Dispatched   bool      `firestore:"dispatched"`
+	DispatchedAt time.Time `firestore:"dispatched_at"`
+	LeaseUntil   time.Time `firestore:"lease_until"`
+	Attempts     int       `firestore:"attempts"`
+}
+
+type firestoreOutbox struct {
+	client *firestore.Client
+	tm     *TypeMap
+}
+
+// NewFirestoreOutbox returns the outbox the Firestore event store writes to,
+// for an eventstore.OutboxRelay to publish from. Every event type the store
+// saves must be added to tm. Claiming entries queries the outbox collection
+// on dispatched and position, which needs a composite index on the two.
+func NewFirestoreOutbox(ctx context.Context, tm *TypeMap) (eventstore.Outbox, error) {
+	client, err := firestore.NewClient(ctx, "iamkoch")
+	if err != nil {
+		return nil, err
+	}
+	return firestoreOutbox{client, tm}, nil
+}
+
+// Claim reads the oldest undispatched entries and claims them in a
+// transaction, so a concurrent relay that reads the same entries is aborted
+// and retries rather than claiming them too. It stops at the first entry that
+// is leased, so entries are never claimed ahead of an older one.
+func (f firestoreOutbox) Claim(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]eventstore.OutboxEntry, error) {
+	ox := f.client.Collection("outbox")
+	var claimed []eventstore.OutboxEntry
+
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, transaction *firestore.Transaction) error {
+		claimed = make([]eventstore.OutboxEntry, 0)
+		q := ox.Where("dispatched", "==", false).OrderBy("position", firestore.Asc).Limit(limit)
+		docs, err := transaction.Documents(q).GetAll()
+		if err != nil {
+			return err
+		}
+
+		for _, doc := range docs {
+			var dbo dbOutboxEntry
+			if err = doc.DataTo(&dbo); err != nil {
+				return err
+			}
+			if dbo.LeaseUntil.After(now) {
+				break
+			}
+
+			evt, err := toEvent(f.tm, &dbo.dbEvent)
+			if err != nil {
+				// Move it aside so it does not hold back the entries behind it.
+				slog.With(
+					"id", doc.Ref.ID,
+					"type", dbo.Type,
+					"error", err,
+				).Error("Dead-lettering outbox entry that cannot be decoded")
+				if err = transaction.Set(f.client.Collection("outbox_dead").Doc(doc.Ref.ID), dbo); err != nil {
+					return err
+				}
+				if err = transaction.Delete(doc.Ref); err != nil {
+					return err
+				}
+				continue
+			}
+
+			dbo.Attempts++
+			err = transaction.Update(doc.Ref, []firestore.Update{
+				{Path: "lease_until", Value: now.Add(lease)},
+				{Path: "attempts", Value: dbo.Attempts},
+			})
+			if err != nil {
+				return err
+			}
+
+			claimed = append(claimed, eventstore.OutboxEntry{
+				Id:       doc.Ref.ID,
+				Event:    evt,
+				Attempts: dbo.Attempts,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+func (f firestoreOutbox) MarkDispatched(ctx context.Context, id string) error {
+	_, err := f.client.Collection("outbox").Doc(id).Update(ctx, []firestore.Update{
+		{Path: "dispatched", Value: true},
+		{Path: "dispatched_at", Value: time.Now().UTC()},
+	})
+	return err
+}
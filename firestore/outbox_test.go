@@ -0,0 +1,207 @@
+package store
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	cqrs "github.com/iamkoch/conqueress"
+	"github.com/iamkoch/conqueress/eventstore"
+	"github.com/iamkoch/conqueress/guid"
+	"github.com/iamkoch/conqueress/sample_domain"
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutbox(t *testing.T) {
+	var (
+		es      eventstore.IEventStore
+		outbox  eventstore.Outbox
+		created sample_domain.InventoryItemCreated
+		claimed []eventstore.OutboxEntry
+		err     error
+	)
+	ensure.That("saved events wait in the outbox until they are dispatched", func(s *ensure.Scenario) {
+		s.Background("Given an available firestore event store and its outbox", func() {
+			tm := NewTypeMap().Add(sample_domain.InventoryItemCreated{})
+			es, err = NewFirestoreEventStore(context.Background(), tm)
+			require.Nil(t, err)
+			outbox, err = NewFirestoreOutbox(context.Background(), tm)
+			require.Nil(t, err)
+			drainOutbox(t, outbox)
+		})
+
+		s.When("I save an event", func() {
+			created = cqrs.NewEvent[sample_domain.InventoryItemCreated](func(s *sample_domain.InventoryItemCreated) {
+				s.Id = guid.New()
+				s.Name = "outboxed"
+			})
+			require.Nil(t, es.SaveEvents(reflect.TypeOf(sample_domain.InventoryItem{}).Name(), guid.New(), []cqrs.Event{created}, -1))
+			claimed, err = outbox.Claim(context.Background(), time.Now().UTC(), 1000, time.Minute)
+		})
+
+		s.Then("it should be claimed from the outbox", func() {
+			require.Nil(t, err)
+			var found *eventstore.OutboxEntry
+			for i := range claimed {
+				if claimed[i].Id == created.MsgId().String() {
+					found = &claimed[i]
+				}
+			}
+			require.NotNil(t, found)
+			assert.Equal(t, "outboxed", found.Event.(sample_domain.InventoryItemCreated).Name)
+		})
+
+		s.And("it should not be claimed again once dispatched", func() {
+			require.Nil(t, outbox.MarkDispatched(context.Background(), created.MsgId().String()))
+			claimed, err = outbox.Claim(context.Background(), time.Now().UTC().Add(time.Hour), 1000, time.Minute)
+			require.Nil(t, err)
+			for _, c := range claimed {
+				assert.NotEqual(t, created.MsgId().String(), c.Id)
+			}
+		})
+	}, t)
+}
+
+// drainOutbox dispatches every entry earlier tests left in the outbox, so
+// that none of them, leased, holds back the entries a test saves.
+func drainOutbox(t *testing.T, outbox eventstore.Outbox) {
+	later := time.Now().UTC().Add(24 * time.Hour)
+	for {
+		claimed, err := outbox.Claim(context.Background(), later, 100, time.Minute)
+		require.Nil(t, err)
+		if len(claimed) == 0 {
+			return
+		}
+		for _, c := range claimed {
+			require.Nil(t, outbox.MarkDispatched(context.Background(), c.Id))
+		}
+	}
+}
+
+func TestOutboxOrdering(t *testing.T) {
+	var (
+		es      eventstore.IEventStore
+		outbox  eventstore.Outbox
+		first   sample_domain.InventoryItemCreated
+		second  sample_domain.InventoryItemCreated
+		claimed []eventstore.OutboxEntry
+		err     error
+	)
+	ensure.That("a leased entry holds back the entries saved after it", func(s *ensure.Scenario) {
+		s.Background("Given an available firestore event store and its outbox", func() {
+			tm := NewTypeMap().Add(sample_domain.InventoryItemCreated{}).Add(sample_domain.InventoryItemRenamed{})
+			es, err = NewFirestoreEventStore(context.Background(), tm)
+			require.Nil(t, err)
+			outbox, err = NewFirestoreOutbox(context.Background(), tm)
+			require.Nil(t, err)
+			drainOutbox(t, outbox)
+		})
+
+		s.When("I save two events and claim only the first", func() {
+			for _, e := range []*sample_domain.InventoryItemCreated{&first, &second} {
+				*e = cqrs.NewEvent[sample_domain.InventoryItemCreated](func(s *sample_domain.InventoryItemCreated) {
+					s.Id = guid.New()
+					s.Name = "ordered"
+				})
+				require.Nil(t, es.SaveEvents("InventoryItem", e.Id, []cqrs.Event{*e}, -1))
+			}
+			claimed, err = outbox.Claim(context.Background(), time.Now().UTC(), 1, time.Minute)
+			require.Nil(t, err)
+			require.Len(t, claimed, 1)
+			require.Equal(t, first.MsgId().String(), claimed[0].Id)
+		})
+
+		s.Then("the second should not be claimed while the first is leased", func() {
+			claimed, err = outbox.Claim(context.Background(), time.Now().UTC(), 1000, time.Minute)
+			require.Nil(t, err)
+			assert.Empty(t, claimed)
+		})
+
+		s.And("it should be claimed once the first is dispatched", func() {
+			require.Nil(t, outbox.MarkDispatched(context.Background(), first.MsgId().String()))
+			claimed, err = outbox.Claim(context.Background(), time.Now().UTC(), 1000, time.Minute)
+			require.Nil(t, err)
+			require.Len(t, claimed, 1)
+			assert.Equal(t, second.MsgId().String(), claimed[0].Id)
+			require.Nil(t, outbox.MarkDispatched(context.Background(), second.MsgId().String()))
+		})
+	}, t)
+}
+
+// InventoryItemRenamed has the name of sample_domain.InventoryItemRenamed but
+// a body it does not fit, as an event whose type has changed since it was
+// saved does.
+type InventoryItemRenamed struct {
+	*cqrs.BaseEvent
+	NewName int
+}
+
+func TestOutboxPoisonEntries(t *testing.T) {
+	var (
+		es      eventstore.IEventStore
+		outbox  eventstore.Outbox
+		full    eventstore.Outbox
+		renamed sample_domain.InventoryItemRenamed
+		created sample_domain.InventoryItemCreated
+		claimed []eventstore.OutboxEntry
+		err     error
+	)
+	claimedIds := func(entries []eventstore.OutboxEntry) []string {
+		ids := make([]string, 0, len(entries))
+		for _, e := range entries {
+			ids = append(ids, e.Id)
+		}
+		return ids
+	}
+	for _, poison := range []struct {
+		entry string
+		tm    *TypeMap
+	}{
+		{"whose type is not in the type map", NewTypeMap().Add(sample_domain.InventoryItemCreated{})},
+		{"whose body does not fit its type", NewTypeMap().Add(sample_domain.InventoryItemCreated{}).Add(InventoryItemRenamed{})},
+	} {
+		ensure.That("an entry "+poison.entry+" does not hold back the others", func(s *ensure.Scenario) {
+			s.Background("Given a firestore event store and an outbox that cannot decode an event type", func() {
+				tm := NewTypeMap().Add(sample_domain.InventoryItemCreated{}).Add(sample_domain.InventoryItemRenamed{})
+				es, err = NewFirestoreEventStore(context.Background(), tm)
+				require.Nil(t, err)
+				full, err = NewFirestoreOutbox(context.Background(), tm)
+				require.Nil(t, err)
+				outbox, err = NewFirestoreOutbox(context.Background(), poison.tm)
+				require.Nil(t, err)
+				drainOutbox(t, full)
+			})
+
+			s.When("an event of that type is saved before another and the outbox is claimed", func() {
+				id := guid.New()
+				created = cqrs.NewEvent[sample_domain.InventoryItemCreated](func(s *sample_domain.InventoryItemCreated) {
+					s.Id = id
+					s.Name = "after the poison"
+				})
+				renamed = cqrs.NewEvent[sample_domain.InventoryItemRenamed](func(s *sample_domain.InventoryItemRenamed) {
+					s.Id = guid.New()
+					s.NewName = "poison"
+				})
+				require.Nil(t, es.SaveEvents("InventoryItem", renamed.Id, []cqrs.Event{renamed}, -1))
+				require.Nil(t, es.SaveEvents("InventoryItem", id, []cqrs.Event{created}, -1))
+				claimed, err = outbox.Claim(context.Background(), time.Now().UTC(), 1000, time.Minute)
+			})
+
+			s.Then("the other event should still be claimed", func() {
+				require.Nil(t, err)
+				assert.Contains(t, claimedIds(claimed), created.MsgId().String())
+				assert.NotContains(t, claimedIds(claimed), renamed.MsgId().String())
+				require.Nil(t, outbox.MarkDispatched(context.Background(), created.MsgId().String()))
+			})
+
+			s.And("the undecodable entry should be moved out of the outbox", func() {
+				claimed, err = full.Claim(context.Background(), time.Now().UTC().Add(time.Hour), 1000, time.Minute)
+				require.Nil(t, err)
+				assert.NotContains(t, claimedIds(claimed), renamed.MsgId().String())
+			})
+		}, t)
+	}
+}
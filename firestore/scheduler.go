@@ -0,0 +1,156 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	cqrs "github.com/iamkoch/conqueress"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type dbScheduledCommand struct {
+	Id            string    `firestore:"id"`
+	Type          string    `firestore:"type"`
+	Body          string    `firestore:"body"`
+	DueAt         time.Time `firestore:"due_at"`
+	Attempts      int       `firestore:"attempts"`
+	CorrelationId string    `firestore:"correlation_id"`
+	CausationId   string    `firestore:"causation_id"`
+}
+
+type firestoreCommandScheduler struct {
+	client *firestore.Client
+	tm     *TypeMap
+}
+
+// NewFirestoreCommandScheduler returns a cqrs.CommandScheduler that keeps
+// scheduled commands in the scheduled_commands collection, so they survive
+// restarts. Commands are stored as JSON, so only their exported fields are
+// kept, and every scheduled command type must be added to tm.
+func NewFirestoreCommandScheduler(ctx context.Context, tm *TypeMap) (cqrs.CommandScheduler, error) {
+	client, err := firestore.NewClient(ctx, "iamkoch")
+
+	if err != nil {
+		fmt.Println("Error creating client ", err)
+		return nil, err
+	}
+
+	return firestoreCommandScheduler{client, tm}, nil
+}
+
+func (f firestoreCommandScheduler) Schedule(ctx context.Context, cmd cqrs.ScheduledCommand) error {
+	body, err := json.Marshal(cmd.Command)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.client.Collection("scheduled_commands").Doc(cmd.Id).Create(ctx, dbScheduledCommand{
+		Id:            cmd.Id,
+		Type:          reflect.TypeOf(cmd.Command).Name(),
+		Body:          string(body),
+		DueAt:         cmd.DueAt,
+		Attempts:      cmd.Attempts,
+		CorrelationId: cmd.CorrelationId,
+		CausationId:   cmd.CausationId,
+	})
+	return err
+}
+
+func (f firestoreCommandScheduler) Cancel(ctx context.Context, id string) error {
+	ref := f.client.Collection("scheduled_commands").Doc(id)
+	return f.client.RunTransaction(ctx, func(ctx context.Context, transaction *firestore.Transaction) error {
+		if _, err := transaction.Get(ref); err != nil {
+			if status.Code(err) == codes.NotFound {
+				return cqrs.ErrScheduledCommandNotFound
+			}
+			return err
+		}
+		return transaction.Delete(ref)
+	})
+}
+
+// Due claims commands in a transaction, so a concurrent poller that reads the
+// same commands is aborted and retries rather than claiming them too.
+func (f firestoreCommandScheduler) Due(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]cqrs.ScheduledCommand, error) {
+	sc := f.client.Collection("scheduled_commands")
+	var due []cqrs.ScheduledCommand
+
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, transaction *firestore.Transaction) error {
+		due = make([]cqrs.ScheduledCommand, 0)
+		q := sc.Where("due_at", "<=", now).OrderBy("due_at", firestore.Asc).Limit(limit)
+		docs, err := transaction.Documents(q).GetAll()
+		if err != nil {
+			return err
+		}
+
+		for _, doc := range docs {
+			var dbc dbScheduledCommand
+			if err = doc.DataTo(&dbc); err != nil {
+				return err
+			}
+			cmd, err := f.toCommand(&dbc)
+			if err != nil {
+				// Move it aside so it does not hold back the commands behind it.
+				slog.With(
+					"id", dbc.Id,
+					"type", dbc.Type,
+					"error", err,
+				).Error("Dead-lettering scheduled command that cannot be decoded")
+				if err = transaction.Set(f.client.Collection("scheduled_commands_dead").Doc(dbc.Id), dbc); err != nil {
+					return err
+				}
+				if err = transaction.Delete(doc.Ref); err != nil {
+					return err
+				}
+				continue
+			}
+
+			dbc.Attempts++
+			err = transaction.Update(doc.Ref, []firestore.Update{
+				{Path: "due_at", Value: now.Add(lease)},
+				{Path: "attempts", Value: dbc.Attempts},
+			})
+			if err != nil {
+				return err
+			}
+
+			due = append(due, cqrs.ScheduledCommand{
+				Id:            dbc.Id,
+				Command:       cmd,
+				DueAt:         dbc.DueAt,
+				Attempts:      dbc.Attempts,
+				CorrelationId: dbc.CorrelationId,
+				CausationId:   dbc.CausationId,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return due, nil
+}
+
+func (f firestoreCommandScheduler) Complete(ctx context.Context, id string) error {
+	_, err := f.client.Collection("scheduled_commands").Doc(id).Delete(ctx)
+	return err
+}
+
+func (f firestoreCommandScheduler) toCommand(dbc *dbScheduledCommand) (cqrs.Command, error) {
+	t := f.tm.Get(dbc.Type)
+	if t == nil {
+		return nil, fmt.Errorf("type %s is not in the type map", dbc.Type)
+	}
+
+	v := reflect.New(t)
+	if err := json.Unmarshal([]byte(dbc.Body), v.Interface()); err != nil {
+		return nil, err
+	}
+	return v.Elem().Interface(), nil
+}
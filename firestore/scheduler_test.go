@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cqrs "github.com/iamkoch/conqueress"
+	"github.com/iamkoch/conqueress/guid"
+	"github.com/iamkoch/conqueress/sample_domain"
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandScheduler(t *testing.T) {
+	var (
+		cs      cqrs.CommandScheduler
+		id      = guid.New().String()
+		cmd     = sample_domain.NewCreateInventoryItem(guid.New(), "scheduled")
+		dueAt   = time.Now().UTC().Add(-time.Second)
+		claimed []cqrs.ScheduledCommand
+		err     error
+	)
+	ensure.That("scheduled commands are claimed once they are due", func(s *ensure.Scenario) {
+		s.Background("Given an available firestore command scheduler", func() {
+			tm := NewTypeMap().Add(sample_domain.CreateInventoryItem{})
+			cs, err = NewFirestoreCommandScheduler(context.Background(), tm)
+			require.Nil(t, err)
+		})
+
+		s.When("I schedule a command and it falls due", func() {
+			require.Nil(t, cs.Schedule(context.Background(), cqrs.ScheduledCommand{
+				Id:      id,
+				Command: cmd,
+				DueAt:   dueAt,
+			}))
+			claimed, err = cs.Due(context.Background(), time.Now().UTC(), 100, time.Minute)
+		})
+
+		s.Then("it should be claimed with its command and due time intact", func() {
+			require.Nil(t, err)
+			var found *cqrs.ScheduledCommand
+			for i := range claimed {
+				if claimed[i].Id == id {
+					found = &claimed[i]
+				}
+			}
+			require.NotNil(t, found)
+			assert.Equal(t, cmd, found.Command)
+			assert.WithinDuration(t, dueAt, found.DueAt, time.Millisecond)
+			assert.Equal(t, 1, found.Attempts)
+		})
+
+		s.And("it should not be claimed again within its lease", func() {
+			claimed, err = cs.Due(context.Background(), time.Now().UTC(), 100, time.Minute)
+			require.Nil(t, err)
+			for _, c := range claimed {
+				assert.NotEqual(t, id, c.Id)
+			}
+			require.Nil(t, cs.Complete(context.Background(), id))
+			assert.ErrorIs(t, cs.Cancel(context.Background(), id), cqrs.ErrScheduledCommandNotFound)
+		})
+	}, t)
+}
+
+func TestCommandSchedulerPoisonEntries(t *testing.T) {
+	var (
+		cs      cqrs.CommandScheduler
+		good    = guid.New().String()
+		poison  = guid.New().String()
+		claimed []cqrs.ScheduledCommand
+		err     error
+	)
+	ensure.That("a command that cannot be decoded does not hold back the others", func(s *ensure.Scenario) {
+		s.Background("Given a firestore command scheduler missing a command type", func() {
+			tm := NewTypeMap().Add(sample_domain.CreateInventoryItem{})
+			cs, err = NewFirestoreCommandScheduler(context.Background(), tm)
+			require.Nil(t, err)
+		})
+
+		s.When("a command of the missing type falls due before another", func() {
+			require.Nil(t, cs.Schedule(context.Background(), cqrs.ScheduledCommand{
+				Id:      poison,
+				Command: sample_domain.NewRenameInventoryItem(guid.New(), "poison"),
+				DueAt:   time.Now().UTC().Add(-2 * time.Second),
+			}))
+			require.Nil(t, cs.Schedule(context.Background(), cqrs.ScheduledCommand{
+				Id:      good,
+				Command: sample_domain.NewCreateInventoryItem(guid.New(), "good"),
+				DueAt:   time.Now().UTC().Add(-time.Second),
+			}))
+			claimed, err = cs.Due(context.Background(), time.Now().UTC(), 100, time.Minute)
+		})
+
+		s.Then("the other command should still be claimed", func() {
+			require.Nil(t, err)
+			var ids []string
+			for _, c := range claimed {
+				ids = append(ids, c.Id)
+			}
+			assert.Contains(t, ids, good)
+			assert.NotContains(t, ids, poison)
+			require.Nil(t, cs.Complete(context.Background(), good))
+		})
+
+		s.And("the undecodable command should be moved out of the scheduler", func() {
+			assert.ErrorIs(t, cs.Cancel(context.Background(), poison), cqrs.ErrScheduledCommandNotFound)
+		})
+	}, t)
+}
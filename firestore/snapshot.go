@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/iamkoch/conqueress/eventstore"
+)
+
+type dbSnapshot struct {
+	AggregateId   string    `firestore:"aggregate_id"`
+	AggregateType string    `firestore:"aggregate_type"`
+	Version       int       `firestore:"version"`
+	Schema        int       `firestore:"schema"`
+	Data          []byte    `firestore:"data"`
+	TakenAt       time.Time `firestore:"taken_at"`
+}
+
+type firestoreSnapshotStore struct {
+	client *firestore.Client
+}
+
+// NewFirestoreSnapshotStore returns an eventstore.SnapshotStore that keeps
+// snapshots in the snapshots collection, one document per aggregate and
+// version. LatestSnapshot needs the composite index on aggregate_id and
+// version in firestore.indexes.json.
+func NewFirestoreSnapshotStore(ctx context.Context) (eventstore.SnapshotStore, error) {
+	client, err := firestore.NewClient(ctx, "iamkoch")
+	if err != nil {
+		return nil, err
+	}
+	return firestoreSnapshotStore{client}, nil
+}
+
+func (s firestoreSnapshotStore) SaveSnapshot(ctx context.Context, snapshot eventstore.Snapshot) error {
+	id := fmt.Sprintf("%s:%d", snapshot.AggregateId, snapshot.Version)
+	_, err := s.client.Collection("snapshots").Doc(id).Set(ctx, dbSnapshot{
+		AggregateId:   snapshot.AggregateId,
+		AggregateType: snapshot.AggregateType,
+		Version:       snapshot.Version,
+		Schema:        snapshot.Schema,
+		Data:          snapshot.Data,
+		TakenAt:       snapshot.TakenAt,
+	})
+	return err
+}
+
+func (s firestoreSnapshotStore) LatestSnapshot(ctx context.Context, aggregateId string) (eventstore.Snapshot, error) {
+	docs, err := s.client.Collection("snapshots").
+		Where("aggregate_id", "==", aggregateId).
+		OrderBy("version", firestore.Desc).
+		Limit(1).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return eventstore.Snapshot{}, err
+	}
+	if len(docs) == 0 {
+		return eventstore.Snapshot{}, eventstore.ErrSnapshotNotFound
+	}
+
+	var dbs dbSnapshot
+	if err = docs[0].DataTo(&dbs); err != nil {
+		return eventstore.Snapshot{}, err
+	}
+	return eventstore.Snapshot{
+		AggregateId:   dbs.AggregateId,
+		AggregateType: dbs.AggregateType,
+		Version:       dbs.Version,
+		Schema:        dbs.Schema,
+		Data:          dbs.Data,
+		TakenAt:       dbs.TakenAt.UTC(),
+	}, nil
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iamkoch/conqueress/eventstore"
+	"github.com/iamkoch/conqueress/guid"
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotStore(t *testing.T) {
+	var (
+		snapshots eventstore.SnapshotStore
+		id        string
+		latest    eventstore.Snapshot
+		err       error
+	)
+	ensure.That("the latest snapshot of an aggregate is the one with the highest version", func(s *ensure.Scenario) {
+		s.Background("Given an available firestore snapshot store", func() {
+			snapshots, err = NewFirestoreSnapshotStore(context.Background())
+			require.Nil(t, err)
+		})
+
+		s.When("I save two snapshots of an aggregate and read the latest", func() {
+			id = guid.New().String()
+			for _, v := range []int{99, 199} {
+				require.Nil(t, snapshots.SaveSnapshot(context.Background(), eventstore.Snapshot{
+					AggregateId:   id,
+					AggregateType: "InventoryItem",
+					Version:       v,
+					Schema:        1,
+					Data:          []byte("state"),
+					TakenAt:       time.Now().UTC(),
+				}))
+			}
+			latest, err = snapshots.LatestSnapshot(context.Background(), id)
+		})
+
+		s.Then("it should be the later one", func() {
+			require.Nil(t, err)
+			assert.Equal(t, 199, latest.Version)
+			assert.Equal(t, []byte("state"), latest.Data)
+		})
+
+		s.And("an aggregate without snapshots should have none", func() {
+			_, err = snapshots.LatestSnapshot(context.Background(), guid.New().String())
+			assert.ErrorIs(t, err, eventstore.ErrSnapshotNotFound)
+		})
+	}, t)
+}
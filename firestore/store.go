@@ -9,6 +9,9 @@ import (
 	cqrs "github.com/iamkoch/conqueress"
 	"github.com/iamkoch/conqueress/eventstore"
 	"github.com/iamkoch/conqueress/guid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/api/iterator"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -17,6 +20,14 @@ import (
 	"time"
 )
 
+var tracer = otel.Tracer("github.com/iamkoch/conqueress/firestore")
+
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		append(attrs, attribute.String("db.system", "firestore"))...,
+	))
+}
+
 type SimpleEnvelope struct {
 	Id            string `firestore:"id"`
 	CorrelationId string `firestore:"correlation_id"`
@@ -31,13 +42,7 @@ type Envelope struct {
 	AggregateId string `firestore:"aggregate_id"`
 }
 
-func createDbEvent(
-	e cqrs.Event,
-	aggName string,
-	cor guid.Guid,
-	cau guid.Guid,
-	aid guid.Guid,
-	v int) (*dbEvent, error) {
+func createDbEvent(e cqrs.Event, md cqrs.Metadata) (*dbEvent, error) {
 	bytes, err := json.Marshal(e)
 	if err != nil {
 		fmt.Println(err)
@@ -46,17 +51,43 @@ func createDbEvent(
 
 	return &dbEvent{
 		Id:            e.MsgId().String(),
-		AggregateId:   aid.String(),
-		AggregateType: aggName,
+		AggregateId:   md.AggregateId,
+		AggregateType: md.AggregateType,
 		Body:          string(bytes),
 		Type:          reflect.TypeOf(e).Name(),
-		Version:       v,
-		Timestamp:     time.Now().UTC().Unix(),
-		CorrelationId: cor.String(),
-		CausationId:   cau.String(),
+		Version:       md.Version,
+		Position:      md.Position,
+		Timestamp:     md.RecordedAt.Unix(),
+		OccurredAt:    md.OccurredAt.UnixNano(),
+		RecordedAt:    md.RecordedAt.UnixNano(),
+		CorrelationId: md.CorrelationId,
+		CausationId:   md.CausationId,
+		UserId:        md.UserId,
+		TenantId:      md.TenantId,
 	}, nil
 }
 
+// lastPosition reads the last global position handed out from the events
+// counter through the transaction, so a concurrent save aborts this one
+// rather than reuse its positions. Every save updates the same counter
+// document, so saves to different aggregates are serialised on it.
+func lastPosition(transaction *firestore.Transaction, counter *firestore.DocumentRef) (int64, error) {
+	doc, err := transaction.Get(counter)
+	if status.Code(err) == codes.NotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var c struct {
+		Position int64 `firestore:"position"`
+	}
+	if err = doc.DataTo(&c); err != nil {
+		return 0, err
+	}
+	return c.Position, nil
+}
+
 func createEnvelope(
 	e cqrs.Event,
 	cor guid.Guid,
@@ -105,10 +136,12 @@ func envelopeToEvent(t reflect.Type, e *dbEvent) (cqrs.Event, error) {
 	newP := v.Interface()
 
 	// Unmarshal to reflected struct pointer
-	json.Unmarshal([]byte(e.Body), newP)
+	if err := json.Unmarshal([]byte(e.Body), newP); err != nil {
+		return nil, err
+	}
 
 	event := dereferenceIfPtr(newP).(cqrs.Event)
-	event.WithVersion(e.Version)
+	eventstore.Restore(event, e.metadata())
 	return event, nil
 }
 
@@ -119,9 +152,32 @@ type dbEvent struct {
 	Body          string `firestore:"body"`
 	Type          string `firestore:"type"`
 	Version       int    `firestore:"version"`
+	Position      int64  `firestore:"position"`
 	Timestamp     int64  `firestore:"timestamp"`
+	OccurredAt    int64  `firestore:"occurred_at"`
+	RecordedAt    int64  `firestore:"recorded_at"`
 	CorrelationId string `firestore:"correlation_id"`
 	CausationId   string `firestore:"causation_id"`
+	UserId        string `firestore:"user_id"`
+	TenantId      string `firestore:"tenant_id"`
+}
+
+// metadata returns the metadata stored alongside the event. The times are
+// stored as Unix nanoseconds, because Firestore timestamps only keep
+// microseconds.
+func (e *dbEvent) metadata() cqrs.Metadata {
+	return cqrs.Metadata{
+		OccurredAt:    time.Unix(0, e.OccurredAt).UTC(),
+		RecordedAt:    time.Unix(0, e.RecordedAt).UTC(),
+		AggregateId:   e.AggregateId,
+		AggregateType: e.AggregateType,
+		Version:       e.Version,
+		Position:      e.Position,
+		CorrelationId: e.CorrelationId,
+		CausationId:   e.CausationId,
+		UserId:        e.UserId,
+		TenantId:      e.TenantId,
+	}
 }
 
 type dbAggregate struct {
@@ -161,10 +217,22 @@ func tryGetExistingAggregate(
 }
 
 func (f firestoreEventStore) SaveEvents(aggName string, aggregateId guid.Guid, events []cqrs.Event, expectedVersion int) error {
+	return f.SaveEventsContext(context.Background(), aggName, aggregateId, events, expectedVersion)
+}
+
+func (f firestoreEventStore) SaveEventsContext(ctx context.Context, aggName string, aggregateId guid.Guid, events []cqrs.Event, expectedVersion int) (err error) {
+	ctx, span := startSpan(ctx, "SaveEvents",
+		eventstore.AggregateTypeKey.String(aggName),
+		eventstore.AggregateIdKey.String(aggregateId.String()),
+		eventstore.EventCountKey.Int(len(events)))
+	defer func() { eventstore.EndSpan(span, err) }()
+	defer eventstore.ObserveTransaction("firestore", "SaveEvents", time.Now())
+
 	ec := f.client.Collection("events")
 	ac := f.client.Collection("aggregates")
+	ox := f.client.Collection("outbox")
 
-	err := f.client.RunTransaction(context.TODO(), func(ctx context.Context, transaction *firestore.Transaction) error {
+	err = f.client.RunTransaction(ctx, func(ctx context.Context, transaction *firestore.Transaction) error {
 
 		getDefaultAggregate := func() *dbAggregate {
 			return &dbAggregate{Id: aggregateId.String(), Version: 0, IsNew: true}
@@ -175,14 +243,24 @@ func (f firestoreEventStore) SaveEvents(aggName string, aggregateId guid.Guid, e
 		}
 
 		if e := checkConcurrency(expectedVersion, dbAgg); e != nil {
-			return eventstore.ErrConcurrencyException
+			eventstore.CountConcurrencyConflict(aggName)
+			return fmt.Errorf("%w: %v", eventstore.ErrConcurrencyException, e)
+		}
+
+		counter := f.client.Collection("counters").Doc("events")
+		position, e := lastPosition(transaction, counter)
+		if e != nil {
+			return e
 		}
 
 		ev := expectedVersion
+		recordedAt := time.Now().UTC()
 
 		for _, event := range events {
 			ev++
-			dbe, e := createDbEvent(event, aggName, guid.New(), guid.New(), aggregateId, ev)
+			position++
+			md := eventstore.Record(event, aggName, aggregateId.String(), ev, position, recordedAt)
+			dbe, e := createDbEvent(event, md)
 			if e != nil {
 				return e
 			}
@@ -192,6 +270,15 @@ func (f firestoreEventStore) SaveEvents(aggName string, aggregateId guid.Guid, e
 				fmt.Println("Error saving event ", e)
 				return e
 			}
+
+			e = transaction.Set(ox.Doc(dbe.Id), dbOutboxEntry{dbEvent: *dbe})
+			if e != nil {
+				return e
+			}
+		}
+
+		if e = transaction.Set(counter, map[string]any{"position": position}); e != nil {
+			return e
 		}
 
 		dbAgg.Version = ev
@@ -230,9 +317,18 @@ func checkConcurrency(expectedVersion int, a *dbAggregate) error {
 }
 
 func (f firestoreEventStore) GetEventsForAggregate(aggregateId guid.Guid) []cqrs.Event {
+	return f.GetEventsForAggregateContext(context.Background(), aggregateId)
+}
+
+func (f firestoreEventStore) GetEventsForAggregateContext(ctx context.Context, aggregateId guid.Guid) []cqrs.Event {
+	ctx, span := startSpan(ctx, "GetEventsForAggregate",
+		eventstore.AggregateIdKey.String(aggregateId.String()))
+	defer span.End()
+	defer eventstore.ObserveTransaction("firestore", "GetEventsForAggregate", time.Now())
+
 	ec := f.client.Collection("events")
 	q := ec.Query.Where("aggregate_id", "==", aggregateId.String())
-	iter := q.Documents(context.TODO())
+	iter := q.Documents(ctx)
 	defer iter.Stop()
 
 	envelopes := make([]dbEvent, 0)
@@ -221,8 +221,8 @@ func TestConcurrency(t *testing.T) {
 		}
 		repo := eventstore.NewRepository[*sample_domain.InventoryItem](s, sample_domain.DefaultInventoryItem)
 		commands := sample_domain.NewInventoryCommandHandler(repo)
-		m.RegisterCommandHandler(reflect.TypeOf(sample_domain.CreateInventoryItem{}), commands.HandleCreateInventoryItem)
-		m.RegisterCommandHandler(reflect.TypeOf(sample_domain.RenameInventoryItem{}), commands.HandleRenameInventoryItem)
+		cqrs.RegisterTypedCommandHandler(m, commands.HandleCreateInventoryItem)
+		cqrs.RegisterTypedCommandHandler(m, commands.HandleRenameInventoryItem)
 
 		handler := newTestPublisher()
 		m.RegisterEventHandler(reflect.TypeOf(sample_domain.InventoryItemCreated{}), handler.Handle)
@@ -260,8 +260,8 @@ func TestStore(t *testing.T) {
 			}
 			repo := eventstore.NewRepository[*sample_domain.InventoryItem](s, sample_domain.DefaultInventoryItem)
 			commands := sample_domain.NewInventoryCommandHandler(repo)
-			m.RegisterCommandHandler(reflect.TypeOf(sample_domain.CreateInventoryItem{}), commands.HandleCreateInventoryItem)
-			m.RegisterCommandHandler(reflect.TypeOf(sample_domain.RenameInventoryItem{}), commands.HandleRenameInventoryItem)
+			cqrs.RegisterTypedCommandHandler(m, commands.HandleCreateInventoryItem)
+			cqrs.RegisterTypedCommandHandler(m, commands.HandleRenameInventoryItem)
 
 			handler := newTestPublisher()
 			m.RegisterEventHandler(reflect.TypeOf(sample_domain.InventoryItemCreated{}), handler.Handle)
@@ -296,8 +296,8 @@ func TestStore(t *testing.T) {
 			}
 			repo := eventstore.NewRepository[*sample_domain.InventoryItem](s, sample_domain.DefaultInventoryItem)
 			commands := sample_domain.NewInventoryCommandHandler(repo)
-			m.RegisterCommandHandler(reflect.TypeOf(sample_domain.CreateInventoryItem{}), commands.HandleCreateInventoryItem)
-			m.RegisterCommandHandler(reflect.TypeOf(sample_domain.RenameInventoryItem{}), commands.HandleRenameInventoryItem)
+			cqrs.RegisterTypedCommandHandler(m, commands.HandleCreateInventoryItem)
+			cqrs.RegisterTypedCommandHandler(m, commands.HandleRenameInventoryItem)
 
 			handler := newTestPublisher()
 			m.RegisterEventHandler(reflect.TypeOf(sample_domain.InventoryItemCreated{}), handler.Handle)
@@ -392,3 +392,19 @@ func TestConcurrentWritersAtSameVersion(t *testing.T) {
 	require.Equal(t, expectedVersion+1, reloaded.Version(),
 		"the stream must have advanced by exactly one event")
 }
+
+func TestEnvelopeToEvent(t *testing.T) {
+	var err error
+	ensure.That("an event whose body does not fit its type is not decoded", func(s *ensure.Scenario) {
+		s.When("I decode a body with a field of the wrong type", func() {
+			_, err = envelopeToEvent(reflect.TypeOf(InventoryItemRenamed{}), &dbEvent{
+				Type: "InventoryItemRenamed",
+				Body: `{"NewName":"widget"}`,
+			})
+		})
+
+		s.Then("it should fail", func() {
+			require.NotNil(t, err)
+		})
+	}, t)
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	cqrs "github.com/iamkoch/conqueress"
+	"github.com/iamkoch/conqueress/eventstore"
+	"github.com/iamkoch/conqueress/guid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ReadAggregateType needs the composite index on aggregate_type and position
+// in firestore.indexes.json.
+func (f firestoreEventStore) ReadAggregateType(ctx context.Context, aggregateType string, after int64, limit int) ([]eventstore.PositionedEvent, error) {
+	q := f.client.Collection("events").Where("aggregate_type", "==", aggregateType)
+	return f.readByPosition(ctx, "ReadAggregateType", q, after, limit,
+		eventstore.AggregateTypeKey.String(aggregateType))
+}
+
+// ReadEventTypes needs the composite index on type and position in
+// firestore.indexes.json. Firestore takes at most 30 types in one query.
+func (f firestoreEventStore) ReadEventTypes(ctx context.Context, eventTypes []string, after int64, limit int) ([]eventstore.PositionedEvent, error) {
+	q := f.client.Collection("events").Where("type", "in", eventTypes)
+	return f.readByPosition(ctx, "ReadEventTypes", q, after, limit)
+}
+
+// GetEventsForAggregateFrom needs the composite index on aggregate_id and
+// version in firestore.indexes.json.
+func (f firestoreEventStore) GetEventsForAggregateFrom(ctx context.Context, aggregateId guid.Guid, fromVersion int) ([]cqrs.Event, error) {
+	q := f.client.Collection("events").
+		Where("aggregate_id", "==", aggregateId.String()).
+		Where("version", ">=", fromVersion)
+	return f.readVersions(ctx, "GetEventsForAggregateFrom", aggregateId, q)
+}
+
+// GetEventsForAggregateRange needs the composite index on aggregate_id and
+// version in firestore.indexes.json.
+func (f firestoreEventStore) GetEventsForAggregateRange(ctx context.Context, aggregateId guid.Guid, fromVersion, toVersion int) ([]cqrs.Event, error) {
+	q := f.client.Collection("events").
+		Where("aggregate_id", "==", aggregateId.String()).
+		Where("version", ">=", fromVersion).
+		Where("version", "<=", toVersion)
+	return f.readVersions(ctx, "GetEventsForAggregateRange", aggregateId, q)
+}
+
+// readVersions reads the aggregate's events that q matches, in version order.
+func (f firestoreEventStore) readVersions(ctx context.Context, operation string, aggregateId guid.Guid, q firestore.Query) (events []cqrs.Event, err error) {
+	ctx, span := startSpan(ctx, operation, eventstore.AggregateIdKey.String(aggregateId.String()))
+	defer func() { eventstore.EndSpan(span, err) }()
+	defer eventstore.ObserveTransaction("firestore", operation, time.Now())
+
+	docs, err := q.OrderBy("version", firestore.Asc).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	events = make([]cqrs.Event, 0, len(docs))
+	for _, doc := range docs {
+		var dbe dbEvent
+		if err = doc.DataTo(&dbe); err != nil {
+			return nil, err
+		}
+		evt, err := toEvent(f.tm, &dbe)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, evt)
+	}
+	return events, nil
+}
+
+// readByPosition reads up to limit events that q matches and come after the
+// given position, lowest first.
+func (f firestoreEventStore) readByPosition(ctx context.Context, operation string, q firestore.Query, after int64, limit int, attrs ...attribute.KeyValue) (events []eventstore.PositionedEvent, err error) {
+	ctx, span := startSpan(ctx, operation, attrs...)
+	defer func() { eventstore.EndSpan(span, err) }()
+	defer eventstore.ObserveTransaction("firestore", operation, time.Now())
+
+	docs, err := q.Where("position", ">", after).
+		OrderBy("position", firestore.Asc).
+		Limit(limit).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	events = make([]eventstore.PositionedEvent, 0, len(docs))
+	for _, doc := range docs {
+		var dbe dbEvent
+		if err = doc.DataTo(&dbe); err != nil {
+			return nil, err
+		}
+		evt, err := toEvent(f.tm, &dbe)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, eventstore.PositionedEvent{Position: dbe.Position, Event: evt})
+	}
+	return events, nil
+}
+
+// toEvent decodes the event stored in dbe, failing when its type is not in
+// tm or its body does not fit the type.
+func toEvent(tm *TypeMap, dbe *dbEvent) (cqrs.Event, error) {
+	t := tm.Get(dbe.Type)
+	if t == nil {
+		return nil, fmt.Errorf("type %s is not in the type map", dbe.Type)
+	}
+	return envelopeToEvent(t, dbe)
+}
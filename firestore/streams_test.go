@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	cqrs "github.com/iamkoch/conqueress"
+	"github.com/iamkoch/conqueress/eventstore"
+	"github.com/iamkoch/conqueress/guid"
+	"github.com/iamkoch/conqueress/sample_domain"
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAggregateType(t *testing.T) {
+	var (
+		es            eventstore.IEventStore
+		aggregateType string
+		events        []eventstore.PositionedEvent
+		err           error
+	)
+	ensure.That("events can be read by aggregate type", func(s *ensure.Scenario) {
+		s.Background("Given an available firestore event store", func() {
+			es, err = NewFirestoreEventStore(context.Background(), NewTypeMap().Add(sample_domain.InventoryItemCreated{}))
+			require.Nil(t, err)
+		})
+
+		s.When("I save events for two aggregates of a type and read that type", func() {
+			// A type name of its own keeps other tests' events out of the read.
+			aggregateType = "InventoryItem-" + guid.New().String()
+			for _, name := range []string{"first", "second"} {
+				created := cqrs.NewEvent[sample_domain.InventoryItemCreated](func(s *sample_domain.InventoryItemCreated) {
+					s.Id = guid.New()
+					s.Name = name
+				})
+				require.Nil(t, es.SaveEvents(aggregateType, created.Id, []cqrs.Event{created}, -1))
+			}
+			events, err = es.(eventstore.IStreamReader).ReadAggregateType(context.Background(), aggregateType, 0, 10)
+		})
+
+		s.Then("both events should be read in the order they were saved", func() {
+			require.Nil(t, err)
+			require.Len(t, events, 2)
+			assert.Less(t, events[0].Position, events[1].Position)
+			assert.Equal(t, "first", events[0].Event.(sample_domain.InventoryItemCreated).Name)
+			assert.Equal(t, "second", events[1].Event.(sample_domain.InventoryItemCreated).Name)
+		})
+	}, t)
+}
+
+func TestGetEventsForAggregateRange(t *testing.T) {
+	var (
+		es     eventstore.IEventStore
+		id     guid.Guid
+		events []cqrs.Event
+		err    error
+	)
+	ensure.That("part of an aggregate's stream can be read by version", func(s *ensure.Scenario) {
+		s.Background("Given an available firestore event store", func() {
+			es, err = NewFirestoreEventStore(context.Background(), NewTypeMap().
+				Add(sample_domain.InventoryItemCreated{}).
+				Add(sample_domain.InventoryItemRenamed{}))
+			require.Nil(t, err)
+		})
+
+		s.When("I save an item renamed three times and read versions 1 to 2", func() {
+			id = guid.New()
+			stream := []cqrs.Event{cqrs.NewEvent[sample_domain.InventoryItemCreated](func(s *sample_domain.InventoryItemCreated) {
+				s.Id = id
+				s.Name = "first"
+			})}
+			for _, name := range []string{"second", "third", "fourth"} {
+				stream = append(stream, cqrs.NewEvent[sample_domain.InventoryItemRenamed](func(s *sample_domain.InventoryItemRenamed) {
+					s.Id = id
+					s.NewName = name
+				}))
+			}
+			require.Nil(t, es.SaveEvents("InventoryItem", id, stream, -1))
+			events, err = es.(eventstore.IVersionRangeEventStore[guid.Guid]).GetEventsForAggregateRange(context.Background(), id, 1, 2)
+		})
+
+		s.Then("only those versions should be read, in order", func() {
+			require.Nil(t, err)
+			require.Len(t, events, 2)
+			assert.Equal(t, "second", events[0].(sample_domain.InventoryItemRenamed).NewName)
+			assert.Equal(t, "third", events[1].(sample_domain.InventoryItemRenamed).NewName)
+		})
+	}, t)
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+	"github.com/iamkoch/conqueress/eventstore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ReadAll reads events in order of the global position SaveEvents assigns
+// them. Events saved before positions were assigned have none, and are not
+// read.
+func (f firestoreEventStore) ReadAll(ctx context.Context, after int64, limit int) ([]eventstore.PositionedEvent, error) {
+	return f.readByPosition(ctx, "ReadAll", f.client.Collection("events").Query, after, limit)
+}
+
+type dbCheckpoint struct {
+	Position int64 `firestore:"position"`
+}
+
+type firestoreCheckpointStore struct {
+	client *firestore.Client
+}
+
+// NewFirestoreCheckpointStore returns an eventstore.CheckpointStore that
+// keeps subscription checkpoints in the checkpoints collection, one document
+// per subscription.
+func NewFirestoreCheckpointStore(ctx context.Context) (eventstore.CheckpointStore, error) {
+	client, err := firestore.NewClient(ctx, "iamkoch")
+	if err != nil {
+		return nil, err
+	}
+	return firestoreCheckpointStore{client}, nil
+}
+
+func (s firestoreCheckpointStore) Load(ctx context.Context, name string) (int64, error) {
+	doc, err := s.client.Collection("checkpoints").Doc(name).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var c dbCheckpoint
+	if err = doc.DataTo(&c); err != nil {
+		return 0, err
+	}
+	return c.Position, nil
+}
+
+func (s firestoreCheckpointStore) Save(ctx context.Context, name string, position int64) error {
+	_, err := s.client.Collection("checkpoints").Doc(name).Set(ctx, dbCheckpoint{position})
+	return err
+}
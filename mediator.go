@@ -1,69 +1,215 @@
 package conqueress
 
 import (
+	"context"
 	"errors"
 	"log/slog"
-	"math/rand"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/iamkoch/conqueress/metrics"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type CommandHandler func(cmd Command) error
 type EventProcessor func(evt Event) error
 
+// ContextCommandHandler is a CommandHandler that also receives the context the
+// command was dispatched with, so deadlines, cancellation and request-scoped
+// values reach the handler and whatever it calls.
+type ContextCommandHandler func(ctx context.Context, cmd Command) error
+
+// ContextEventProcessor is an EventProcessor that also receives the context
+// the event was published with.
+type ContextEventProcessor func(ctx context.Context, evt Event) error
+
 type Command interface {
 }
 
 type Mediator struct {
-	commandQueue    chan queuedCommand
-	commandHandlers map[reflect.Type]CommandHandler
-	eventProcessors map[reflect.Type][]EventProcessor
-	induceDelay     bool
+	partitions    []chan queuedCommand
+	registry      atomic.Pointer[registry]
+	registryWrite sync.Mutex
+	chaos         *chaos
+	tracer        trace.Tracer
+	metrics       metrics.Metrics
+	instruments   *mediatorMetrics
+
+	workers        int
+	queueDepth     int
+	enqueueTimeout time.Duration
+	partitionKey   PartitionKeyFunc
+
+	defaultRetryPolicy RetryPolicy
+	failureObserver    FailureObserver
+	deadLetters        DeadLetterSink
+
+	deduplication       DeduplicationStore
+	deduplicationWindow time.Duration
+	deduplicating       sync.Mutex
+	inflight            map[string]chan struct{}
+
+	scheduler             CommandScheduler
+	schedulerPollInterval time.Duration
+	schedulerMaxAttempts  int
+	stopScheduling        chan struct{}
+	schedulingStopped     chan struct{}
+
+	lifecycle        sync.Mutex
+	commandsClosed   bool
+	eventsClosed     bool
+	dispatching      sync.WaitGroup
+	publishing       sync.WaitGroup
+	commandsStopped  chan struct{}
+	shutdownOnce     sync.Once
+	shutdownComplete chan struct{}
 }
 
 type queuedCommand struct {
+	ctx                 context.Context
 	cmd                 Command
 	synchronousResponse chan CommandProcessingError
+	resultResponse      chan CommandOutcome
+	delay               time.Duration
 }
 
-func NewMediator(induceDelay bool) *Mediator {
+func (q queuedCommand) respond(result any, err error) {
+	if q.synchronousResponse != nil {
+		q.synchronousResponse <- err
+	}
+	if q.resultResponse != nil {
+		q.resultResponse <- CommandOutcome{result, err}
+	}
+}
+
+// NewMediator creates a mediator configured by opts. Passing true for
+// induceDelay turns on chaos mode with InducedDelayChaos; use WithChaos
+// instead for control over what chaos mode does.
+func NewMediator(induceDelay bool, opts ...MediatorOption) *Mediator {
 	mediator := &Mediator{
-		commandQueue:    make(chan queuedCommand),
-		commandHandlers: make(map[reflect.Type]CommandHandler),
-		eventProcessors: make(map[reflect.Type][]EventProcessor),
-		induceDelay:     induceDelay,
+		workers:      defaultWorkers,
+		queueDepth:   defaultQueueDepth,
+		partitionKey: defaultPartitionKey,
+
+		schedulerMaxAttempts: defaultSchedulerMaxAttempts,
+
+		failureObserver: logFailure,
+		tracer:          defaultTracer(),
+
+		inflight: make(map[string]chan struct{}),
+
+		stopScheduling:    make(chan struct{}),
+		schedulingStopped: make(chan struct{}),
+		commandsStopped:   make(chan struct{}),
+		shutdownComplete:  make(chan struct{}),
+	}
+
+	mediator.registry.Store(newRegistry())
+
+	if induceDelay {
+		opts = append([]MediatorOption{WithChaos(InducedDelayChaos())}, opts...)
+	}
+
+	for _, opt := range opts {
+		opt(mediator)
 	}
+	if mediator.metrics == nil {
+		mediator.metrics = metrics.Default()
+	}
+	mediator.instruments = newMediatorMetrics(mediator.metrics)
+
+	var workers sync.WaitGroup
+	for i := 0; i < mediator.workers; i++ {
+		partition := make(chan queuedCommand, mediator.queueDepth)
+		mediator.partitions = append(mediator.partitions, partition)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			mediator.processCommands(partition)
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(mediator.commandsStopped)
+	}()
+
+	go func() {
+		defer close(mediator.schedulingStopped)
+		if mediator.scheduler != nil {
+			mediator.pollScheduler(mediator.stopScheduling)
+		}
+	}()
 
-	go mediator.processCommands()
 	return mediator
 }
 
-func (m *Mediator) processCommands() {
-	for {
-		select {
-		case cmdReq := <-m.commandQueue:
-			cmd := cmdReq.cmd
-			slog.With(
-				"command", cmd,
-				"type", reflect.TypeOf(cmd),
-			).Debug("Processing command")
-			resp := cmdReq.synchronousResponse
-			handler, _ := m.commandHandlers[reflect.TypeOf(cmd)]
-			if m.induceDelay {
-				time.Sleep(time.Duration(1*rand.Intn(3)) * time.Second)
-			}
+func (h CommandHandler) withContext() ContextCommandHandler {
+	return func(_ context.Context, cmd Command) error {
+		return h(cmd)
+	}
+}
 
-			result := handler(cmd)
+func (p EventProcessor) withContext() ContextEventProcessor {
+	return func(_ context.Context, evt Event) error {
+		return p(evt)
+	}
+}
+
+func (m *Mediator) processCommands(partition chan queuedCommand) {
+	for cmdReq := range partition {
+		m.observeQueueDepth()
+		// The caller may have given up while the command sat in the queue,
+		// in which case it must not run at all.
+		if err := cmdReq.ctx.Err(); err != nil {
 			slog.With(
-				"command", cmd,
-				"type", reflect.TypeOf(cmd),
-				"result", result,
-			).Debug("Command processed")
-			if resp != nil {
-				resp <- result
-			}
+				"command", cmdReq.cmd,
+				"type", reflect.TypeOf(cmdReq.cmd),
+				"error", err,
+			).Debug("Dropping cancelled command")
+			m.countFailed(cmdReq.cmd)
+			cmdReq.respond(nil, err)
+			continue
+		}
+
+		pause(cmdReq.ctx, cmdReq.delay)
+		cmdReq.respond(m.runCommand(cmdReq.ctx, cmdReq.cmd))
+	}
+}
+
+func (m *Mediator) runCommand(ctx context.Context, cmd Command) (value any, err error) {
+	ctx = commandContext(ctx, cmd)
+	ctx, span := m.tracer.Start(ctx, "handle "+reflect.TypeOf(cmd).String(),
+		trace.WithAttributes(CommandTypeKey.String(reflect.TypeOf(cmd).String())))
+	started := time.Now()
+	defer func() {
+		m.observeHandler(cmd, started)
+		if err != nil {
+			m.countFailed(cmd)
 		}
+		endSpan(span, err)
+	}()
+
+	slog.With(
+		"command", cmd,
+		"type", reflect.TypeOf(cmd),
+	).Debug("Processing command")
+	reg := m.snapshot()
+	registration, ok := reg.commandHandlers[reflect.TypeOf(cmd)]
+	if !ok {
+		// The handler was unregistered while the command was queued.
+		return nil, ErrNoHandler
 	}
+	value, err = m.deduplicate(ctx, cmd, registration.resultType, func() (any, error) {
+		return reg.invoke(ctx, cmd, registration.handler)
+	})
+	slog.With(
+		"command", cmd,
+		"type", reflect.TypeOf(cmd),
+		"result", err,
+	).Debug("Command processed")
+	return value, err
 }
 
 func RegisterCommandHandler[T Command](m *Mediator, handler CommandHandler) error {
@@ -71,12 +217,41 @@ func RegisterCommandHandler[T Command](m *Mediator, handler CommandHandler) erro
 	return m.RegisterCommandHandler(reflect.TypeOf(t), handler)
 }
 
+func RegisterContextCommandHandler[T Command](m *Mediator, handler ContextCommandHandler) error {
+	var t T
+	return m.RegisterContextCommandHandler(reflect.TypeOf(t), handler)
+}
+
 func RegisterEventHandlers[T Event](m *Mediator, handlers ...EventProcessor) error {
+	registrations := make([]*processorRegistration, 0, len(handlers))
+	for _, h := range handlers {
+		registrations = append(registrations, newProcessorRegistration(h.withContext(), funcName(h), nil))
+	}
+	return registerEventHandlers[T](m, registrations)
+}
+
+func RegisterContextEventHandlers[T Event](m *Mediator, handlers ...ContextEventProcessor) error {
+	registrations := make([]*processorRegistration, 0, len(handlers))
+	for _, h := range handlers {
+		registrations = append(registrations, newProcessorRegistration(h, funcName(h), nil))
+	}
+	return registerEventHandlers[T](m, registrations)
+}
+
+// RegisterEventProcessor registers a single processor for events of type T,
+// configured by opts.
+func RegisterEventProcessor[T Event](m *Mediator, processor ContextEventProcessor, opts ...ProcessorOption) error {
+	var t T
+	_, err := m.subscribe(reflect.TypeOf(t), newProcessorRegistration(processor, funcName(processor), opts))
+	return err
+}
+
+func registerEventHandlers[T Event](m *Mediator, registrations []*processorRegistration) error {
 	var t T
 	eventType := reflect.TypeOf(t)
 	errors := make([]error, 0)
-	for _, h := range handlers {
-		e := m.RegisterEventHandler(eventType, h)
+	for _, r := range registrations {
+		_, e := m.subscribe(eventType, r)
 		if e != nil {
 			errors = append(errors, e)
 		}
@@ -91,8 +266,12 @@ func RegisterEventHandlers[T Event](m *Mediator, handlers ...EventProcessor) err
 	return nil
 }
 
+// WaitForCommands shuts the mediator down and waits for the work already
+// under way to finish.
+//
+// Deprecated: use Shutdown, which can give up after a deadline.
 func (m *Mediator) WaitForCommands() {
-	close(m.commandQueue)
+	_ = m.Shutdown(context.Background())
 }
 
 type EventRegistrationError struct {
@@ -105,101 +284,197 @@ func (e *EventRegistrationError) Error() string {
 }
 
 func (m *Mediator) RegisterCommandHandler(cmdType reflect.Type, handler CommandHandler) error {
-	if _, exists := m.commandHandlers[cmdType]; exists {
-		return errors.New("command handler already registered")
-	}
-	slog.With(
-		"command", cmdType,
-	).Info("Registering command handler")
-	m.commandHandlers[cmdType] = handler
-	return nil
+	return m.RegisterContextCommandHandler(cmdType, handler.withContext())
 }
 
-func (m *Mediator) RegisterEventHandler(evtType reflect.Type, handler EventProcessor) error {
-	handlers, existing := m.eventProcessors[evtType]
-	if !existing {
-		handlers = make([]EventProcessor, 0)
-	}
-	for _, p := range handlers {
-		if reflect.DeepEqual(p, handler) {
-			return errors.New("processor already registered")
-		}
-	}
-	handlers = append(handlers, handler)
-	m.eventProcessors[evtType] = handlers
-	return nil
+func (m *Mediator) RegisterContextCommandHandler(cmdType reflect.Type, handler ContextCommandHandler) error {
+	_, err := m.Handle(cmdType, handler)
+	return err
+}
+
+func (m *Mediator) RegisterEventHandler(evtType reflect.Type, handler EventProcessor, opts ...ProcessorOption) error {
+	_, err := m.subscribe(evtType, newProcessorRegistration(handler.withContext(), funcName(handler), opts))
+	return err
+}
+
+func (m *Mediator) RegisterContextEventHandler(evtType reflect.Type, handler ContextEventProcessor, opts ...ProcessorOption) error {
+	_, err := m.Subscribe(evtType, handler, opts...)
+	return err
 }
 
 func (m *Mediator) Dispatch(cmd Command, syncResp chan CommandProcessingError) CommandSubmissionError {
+	return m.DispatchContext(context.Background(), cmd, syncResp)
+}
+
+// DispatchContext queues cmd on its partition. When the partition is full it
+// waits for room no longer than the enqueue timeout, giving up with
+// ErrQueueFull, or the context's error if ctx is done first. A command whose
+// context is done by the time it reaches the front of the queue is not run:
+// its context's error is sent to syncResp instead. A command that fails
+// validation is not queued, and a *ValidationError is returned.
+func (m *Mediator) DispatchContext(ctx context.Context, cmd Command, syncResp chan CommandProcessingError) CommandSubmissionError {
+	return m.dispatch(ctx, queuedCommand{ctx: ctx, cmd: cmd, synchronousResponse: syncResp})
+}
+
+func (m *Mediator) dispatch(ctx context.Context, qc queuedCommand) (err CommandSubmissionError) {
+	cmd := qc.cmd
 	of := reflect.TypeOf(cmd)
-	if _, ok := m.commandHandlers[of]; ok {
+	ctx, span := m.tracer.Start(ctx, "dispatch "+of.String(),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(CommandTypeKey.String(of.String())))
+	defer func() {
+		if err != nil {
+			m.countFailed(cmd)
+		} else {
+			m.countDispatched(cmd)
+			m.observeQueueDepth()
+		}
+		endSpan(span, err)
+	}()
+	qc.ctx = ctx
+
+	reg := m.snapshot()
+	if _, ok := reg.commandHandler(of); ok {
+		if err := reg.validate(cmd); err != nil {
+			return err
+		}
+		if !m.beginDispatch() {
+			return ErrMediatorShutdown
+		}
+		defer m.endDispatch()
+
 		slog.With(
 			"type", of,
 			"command", cmd,
 		).Info("Dispatching command")
-		m.commandQueue <- queuedCommand{cmd, syncResp}
-		return nil
+		qc.delay = m.chaos.commandDelay()
+		return m.enqueue(ctx, qc)
 	}
-	return errors.New("no handler registered")
+	return ErrNoHandler
 }
 
 func (m *Mediator) DispatchSync(cmd Command, syncResp chan CommandProcessingError) CommandSubmissionError {
+	return m.DispatchSyncContext(context.Background(), cmd)
+}
+
+// DispatchSyncContext runs the handler for cmd on the calling goroutine and
+// returns its error. It does not run the handler if ctx is already done, or
+// if the command fails validation, returning a *ValidationError instead.
+func (m *Mediator) DispatchSyncContext(ctx context.Context, cmd Command) CommandSubmissionError {
+	_, err := m.dispatchSync(ctx, cmd)
+	return err
+}
+
+func (m *Mediator) dispatchSync(ctx context.Context, cmd Command) (value any, err error) {
 	of := reflect.TypeOf(cmd)
-	if _, ok := m.commandHandlers[of]; ok {
+	ctx, span := m.tracer.Start(ctx, "dispatch "+of.String(),
+		trace.WithAttributes(CommandTypeKey.String(of.String())))
+	// Once the handler runs, runCommand counts its failures.
+	handled := false
+	defer func() {
+		if err != nil && !handled {
+			m.countFailed(cmd)
+		}
+		endSpan(span, err)
+	}()
+
+	reg := m.snapshot()
+	if _, ok := reg.commandHandler(of); ok {
+		if err := reg.validate(cmd); err != nil {
+			return nil, err
+		}
+		if !m.beginDispatch() {
+			return nil, ErrMediatorShutdown
+		}
+		defer m.endDispatch()
+
 		slog.With(
 			"type", of,
 			"command", cmd,
 		).Info("Dispatching command")
-		slog.With(
-			"command", cmd,
-			"type", reflect.TypeOf(cmd),
-		).Debug("Processing command")
-		handler, _ := m.commandHandlers[reflect.TypeOf(cmd)]
-		if m.induceDelay {
-			time.Sleep(time.Duration(1*rand.Intn(3)) * time.Second)
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-
-		result := handler(cmd)
-		slog.With(
-			"command", cmd,
-			"type", reflect.TypeOf(cmd),
-			"result", result,
-		).Debug("Command processed")
-		return result
+		pause(ctx, m.chaos.commandDelay())
+		handled = true
+		m.countDispatched(cmd)
+		return m.runCommand(ctx, cmd)
 	}
-	return errors.New("no handler registered")
+	return nil, ErrNoHandler
 }
 
 func (m *Mediator) Publish(evt Event) error {
-	if processors, ok := m.eventProcessors[reflect.TypeOf(evt)]; ok {
+	return m.PublishContext(context.Background(), evt)
+}
+
+// PublishContext calls each processor on its own goroutine. The processors
+// outlive the call, so they receive ctx's values but not its cancellation.
+// Their failures go to the failure observer and, depending on each
+// processor's retry policy, the dead-letter sink.
+func (m *Mediator) PublishContext(ctx context.Context, evt Event) (err error) {
+	ctx, span := m.startEventSpan(ctx, "publish", evt, trace.WithSpanKind(trace.SpanKindProducer))
+	defer func() { endSpan(span, err) }()
+
+	if processors := m.snapshot().processorsFor(evt); len(processors) > 0 {
+		if !m.beginPublish(len(processors)) {
+			return ErrMediatorShutdown
+		}
+		ctx = context.WithoutCancel(ctx)
 		for _, processor := range processors {
-			go func(p EventProcessor) {
-				if m.induceDelay {
-					time.Sleep(time.Duration(rand.Intn(10)) * time.Second) // Have a variable degree of eventual consistency
-				}
-				p(evt)
+			plan := m.chaos.planDelivery(true)
+			go func(r *processorRegistration) {
+				defer m.endPublish()
+				m.deliver(ctx, evt, r, plan)
 			}(processor)
 		}
 		return nil
 	}
-	return errors.New("no processor registered")
+	return ErrNoProcessor
 }
 
 func (m *Mediator) PublishSync(evt Event) error {
-	if processors, ok := m.eventProcessors[reflect.TypeOf(evt)]; ok {
+	return m.PublishSyncContext(context.Background(), evt)
+}
+
+// PublishSyncContext calls each processor in turn on the calling goroutine,
+// and stops with the context's error once ctx is done. Every processor runs
+// even when an earlier one fails, and the failures whose policy is to report
+// them come back together in an EventProcessingError.
+func (m *Mediator) PublishSyncContext(ctx context.Context, evt Event) (err error) {
+	ctx, span := m.startEventSpan(ctx, "publish", evt)
+	defer func() { endSpan(span, err) }()
+
+	if processors := m.snapshot().processorsFor(evt); len(processors) > 0 {
+		if !m.beginPublish(1) {
+			return ErrMediatorShutdown
+		}
+		defer m.endPublish()
+
+		var failures []ProcessorFailure
 		for _, processor := range processors {
-			func(p EventProcessor) {
-				if m.induceDelay {
-					time.Sleep(time.Duration(rand.Intn(10)) * time.Second) // Have a variable degree of eventual consistency
-				}
-				p(evt)
-			}(processor)
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if f := m.deliver(ctx, evt, processor, m.chaos.planDelivery(false)); f != nil {
+				failures = append(failures, *f)
+			}
+		}
+		if len(failures) > 0 {
+			return &EventProcessingError{Event: evt, Failures: failures}
 		}
 		return nil
 	}
-	return errors.New("no processor registered")
+	return ErrNoProcessor
 }
 
+// ErrNoProcessor is returned when publishing an event that no processor is
+// registered for.
+var ErrNoProcessor = errors.New("no processor registered")
+
+// ErrNoHandler is returned when dispatching a command that no handler is
+// registered for.
+var ErrNoHandler = errors.New("no handler registered")
+
 type CommandProcessingError error
 type CommandSubmissionError error
 
@@ -212,3 +487,16 @@ type EventPublisher interface {
 	Publish(e Event) error
 	PublishSync(e Event) error
 }
+
+// ContextCommandDispatcher is the context-aware counterpart of
+// CommandDispatcher.
+type ContextCommandDispatcher interface {
+	DispatchContext(ctx context.Context, e Command, synchronousResponse chan CommandProcessingError) CommandSubmissionError
+	DispatchSyncContext(ctx context.Context, e Command) CommandSubmissionError
+}
+
+// ContextEventPublisher is the context-aware counterpart of EventPublisher.
+type ContextEventPublisher interface {
+	PublishContext(ctx context.Context, e Event) error
+	PublishSyncContext(ctx context.Context, e Event) error
+}
@@ -1,10 +1,12 @@
 package conqueress
 
 import (
+	"context"
 	"fmt"
 	"github.com/iamkoch/conqueress/guid"
 	"github.com/iamkoch/ensure"
 	"github.com/stretchr/testify/assert"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -112,8 +114,9 @@ func TestPublish(t *testing.T) {
 			mediator = NewMediator(false)
 		})
 
-		s.And("a handler", func() {
-			_ = RegisterEventHandlers[TestEvent](mediator, handler1.Handle, handler2.Handle)
+		s.And("two handlers made from the same method, so named apart", func() {
+			_ = mediator.RegisterEventHandler(reflect.TypeOf(TestEvent{}), handler1.Handle, WithProcessorName("handler1"))
+			_ = mediator.RegisterEventHandler(reflect.TypeOf(TestEvent{}), handler2.Handle, WithProcessorName("handler2"))
 		})
 
 		s.When("I publish an event", func() {
@@ -141,6 +144,76 @@ func TestPublish(t *testing.T) {
 	}, t)
 }
 
+func TestCommandDispatchWithContext(t *testing.T) {
+	var (
+		mediator *Mediator
+		seen     = make(chan any, 1)
+		resp     = make(chan CommandProcessingError, 1)
+	)
+	ensure.That("handlers receive the context commands are dispatched with", func(s *ensure.Scenario) {
+		s.Given("a mediator", func() {
+			mediator = NewMediator(false)
+		})
+
+		s.And("a context aware command handler", func() {
+			_ = RegisterContextCommandHandler[TestCmd](mediator, func(ctx context.Context, cmd Command) error {
+				seen <- ctx.Value(testContextKey{})
+				return nil
+			})
+		})
+
+		s.When("I dispatch a command with a value in its context", func() {
+			ctx := context.WithValue(context.Background(), testContextKey{}, "request-1")
+			_ = mediator.DispatchContext(ctx, TestCmd{}, resp)
+		})
+
+		s.Then("the handler should see the value", func() {
+			assert.Nil(t, <-resp)
+			assert.Equal(t, "request-1", <-seen)
+		})
+	}, t)
+}
+
+func TestCancelledCommandIsNotHandled(t *testing.T) {
+	var (
+		mediator *Mediator
+		handler  *TestCmdHandler
+		resp     = make(chan CommandProcessingError, 1)
+		err      error
+	)
+	ensure.That("a queued command whose context is cancelled does not run", func(s *ensure.Scenario) {
+		s.Given("a mediator with a command handler", func() {
+			mediator = NewMediator(false)
+			handler = &TestCmdHandler{}
+			_ = RegisterCommandHandler[TestCmd](mediator, handler.Handle)
+		})
+
+		s.When("I dispatch a command with a cancelled context", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			err = mediator.DispatchContext(ctx, TestCmd{}, resp)
+		})
+
+		s.Then("the handler should not run", func() {
+			if err == nil {
+				assert.ErrorIs(t, <-resp, context.Canceled)
+			} else {
+				assert.ErrorIs(t, err, context.Canceled)
+			}
+			assert.Empty(t, handler.Received())
+		})
+
+		s.And("DispatchSyncContext should refuse it too", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			assert.ErrorIs(t, mediator.DispatchSyncContext(ctx, TestCmd{}), context.Canceled)
+			assert.Empty(t, handler.Received())
+		})
+	}, t)
+}
+
+type testContextKey struct{}
+
 type TestEvent struct {
 }
 
@@ -211,3 +284,7 @@ func (t *TestCmdHandler) Received() []Command {
 	defer t.mu.Unlock()
 	return append([]Command(nil), t.received...)
 }
+
+func reflectTypeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
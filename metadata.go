@@ -0,0 +1,148 @@
+package conqueress
+
+import (
+	"context"
+	"maps"
+	"time"
+)
+
+// Headers under which events carry the user and tenant they were raised for.
+const (
+	UserIdHeader   = "user-id"
+	TenantIdHeader = "tenant-id"
+)
+
+// Metadata describes an event apart from its payload: when it happened, where
+// it was stored, and the conversation it belongs to.
+//
+// OccurredAt is set when the event is created with NewEvent, or saved if it
+// was not. The event store sets RecordedAt, AggregateId, AggregateType,
+// Version and Position when it saves the event, and sets them again when it
+// loads it. Position is the event's place in the order of every event in the
+// store, starting at 1. CorrelationId, CausationId, UserId and TenantId are
+// kept in Headers, under the header names defined in this package, and
+// recorded from the context when a repository saves the event.
+type Metadata struct {
+	OccurredAt    time.Time
+	RecordedAt    time.Time
+	AggregateId   string
+	AggregateType string
+	Version       int
+	Position      int64
+	CorrelationId string
+	CausationId   string
+	UserId        string
+	TenantId      string
+	Headers       map[string]string
+}
+
+// MetadataCarrier is implemented by events that carry metadata, as every
+// event embedding BaseEvent does.
+type MetadataCarrier interface {
+	Metadata() Metadata
+	SetMetadata(md Metadata)
+}
+
+// storedMetadata is the metadata an event store assigns, which is kept with
+// the event in memory rather than in its payload.
+type storedMetadata struct {
+	recordedAt    time.Time
+	aggregateId   string
+	aggregateType string
+	position      int64
+}
+
+// MetadataOf returns evt's metadata, or none if evt does not carry any.
+// Aggregates, processors and projections use it to read the metadata of the
+// events they receive.
+func MetadataOf(evt Event) Metadata {
+	if mc, ok := evt.(MetadataCarrier); ok {
+		return mc.Metadata()
+	}
+	return Metadata{}
+}
+
+func (b *BaseEvent) Metadata() Metadata {
+	return Metadata{
+		OccurredAt:    b.OccurredAt,
+		RecordedAt:    b.stored.recordedAt,
+		AggregateId:   b.stored.aggregateId,
+		AggregateType: b.stored.aggregateType,
+		Version:       b.Ver,
+		Position:      b.stored.position,
+		CorrelationId: b.Header(CorrelationIdHeader),
+		CausationId:   b.Header(CausationIdHeader),
+		UserId:        b.Header(UserIdHeader),
+		TenantId:      b.Header(TenantIdHeader),
+		Headers:       maps.Clone(b.Headers),
+	}
+}
+
+// SetMetadata replaces the event's metadata with md. The headers in md are
+// added to the event's, and its named IDs override the headers they are kept
+// in when they are not empty.
+func (b *BaseEvent) SetMetadata(md Metadata) {
+	b.OccurredAt = md.OccurredAt
+	b.Ver = md.Version
+	b.stored = storedMetadata{
+		recordedAt:    md.RecordedAt,
+		aggregateId:   md.AggregateId,
+		aggregateType: md.AggregateType,
+		position:      md.Position,
+	}
+	for k, v := range md.Headers {
+		b.SetHeader(k, v)
+	}
+	for header, v := range map[string]string{
+		CorrelationIdHeader: md.CorrelationId,
+		CausationIdHeader:   md.CausationId,
+		UserIdHeader:        md.UserId,
+		TenantIdHeader:      md.TenantId,
+	} {
+		if v != "" {
+			b.SetHeader(header, v)
+		}
+	}
+}
+
+type identityKey struct{}
+
+type identity struct {
+	userId   string
+	tenantId string
+}
+
+// ContextWithIdentity returns a copy of ctx carrying the user and tenant the
+// work is done for. Repositories record them on the events they save, and
+// processors of those events run with them in turn.
+func ContextWithIdentity(ctx context.Context, userId, tenantId string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity{userId, tenantId})
+}
+
+// UserIdFrom returns the user ID in ctx, or "" if there is none.
+func UserIdFrom(ctx context.Context) string {
+	i, _ := ctx.Value(identityKey{}).(identity)
+	return i.userId
+}
+
+// TenantIdFrom returns the tenant ID in ctx, or "" if there is none.
+func TenantIdFrom(ctx context.Context) string {
+	i, _ := ctx.Value(identityKey{}).(identity)
+	return i.tenantId
+}
+
+// InjectIdentity records the user and tenant in ctx on evt, if evt carries
+// headers and does not have them already. Repositories call it for every
+// event they save.
+func InjectIdentity(ctx context.Context, evt Event) {
+	hc, ok := evt.(HeaderCarrier)
+	if !ok {
+		return
+	}
+	if id := UserIdFrom(ctx); id != "" && hc.Header(UserIdHeader) == "" {
+		hc.SetHeader(UserIdHeader, id)
+	}
+	if id := TenantIdFrom(ctx); id != "" && hc.Header(TenantIdHeader) == "" {
+		hc.SetHeader(TenantIdHeader, id)
+	}
+}
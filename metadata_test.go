@@ -0,0 +1,81 @@
+package conqueress
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadata(t *testing.T) {
+	var (
+		shipped itemShipped
+		md      Metadata
+	)
+
+	ensure.That("metadata set on an event reads back, with the named IDs in its headers", func(s *ensure.Scenario) {
+		occurred := time.Date(2024, 3, 1, 12, 0, 0, 123456789, time.UTC)
+
+		s.Given("a new event", func() {
+			shipped = NewEvent[itemShipped]()
+		})
+
+		s.When("I set its metadata", func() {
+			shipped.SetMetadata(Metadata{
+				OccurredAt:    occurred,
+				AggregateId:   "order-1",
+				AggregateType: "Order",
+				Version:       3,
+				Position:      42,
+				CorrelationId: "checkout-1",
+				TenantId:      "acme",
+				Headers:       map[string]string{"source": "web"},
+			})
+			md = MetadataOf(shipped)
+		})
+
+		s.Then("it should read back", func() {
+			assert.Equal(t, occurred, md.OccurredAt)
+			assert.Equal(t, "order-1", md.AggregateId)
+			assert.Equal(t, "Order", md.AggregateType)
+			assert.Equal(t, 3, md.Version)
+			assert.Equal(t, 3, shipped.Version())
+			assert.Equal(t, int64(42), md.Position)
+			assert.Equal(t, "checkout-1", md.CorrelationId)
+			assert.Equal(t, "acme", md.TenantId)
+		})
+
+		s.And("the IDs should be kept in the headers", func() {
+			assert.Equal(t, "web", shipped.Header("source"))
+			assert.Equal(t, "checkout-1", shipped.Header(CorrelationIdHeader))
+			assert.Equal(t, "acme", shipped.Header(TenantIdHeader))
+		})
+	}, t)
+
+	ensure.That("processors run with the user and tenant of the event", func(s *ensure.Scenario) {
+		var (
+			mediator *Mediator
+			tenant   string
+		)
+		s.Given("a processor that records the tenant in its context", func() {
+			mediator = NewMediator(false)
+			_, _ = Subscribe(mediator, func(ctx context.Context, evt itemShipped) error {
+				tenant = TenantIdFrom(ctx)
+				return nil
+			})
+		})
+
+		s.When("I publish an event raised for a tenant", func() {
+			shipped = NewEvent[itemShipped]()
+			InjectIdentity(ContextWithIdentity(context.Background(), "user-1", "acme"), shipped)
+			require.Nil(t, mediator.PublishSync(shipped))
+		})
+
+		s.Then("the processor should see the tenant", func() {
+			assert.Equal(t, "acme", tenant)
+		})
+	}, t)
+}
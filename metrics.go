@@ -0,0 +1,71 @@
+package conqueress
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/iamkoch/conqueress/metrics"
+)
+
+// WithMetrics sets where the mediator reports its metrics. The default is
+// metrics.Default, which discards them until metrics.SetDefault is called.
+//
+// The mediator counts the commands dispatched and failed, and times their
+// handlers, by command type; times event processors and counts their
+// failures, by event type and processor; and reports the number of commands
+// waiting in the queue.
+func WithMetrics(m metrics.Metrics) MediatorOption {
+	return func(mediator *Mediator) {
+		mediator.metrics = m
+	}
+}
+
+type mediatorMetrics struct {
+	commandsDispatched metrics.Counter
+	commandsFailed     metrics.Counter
+	handlerDuration    metrics.Histogram
+	queueDepth         metrics.Gauge
+	processorDuration  metrics.Histogram
+	processorFailures  metrics.Counter
+}
+
+func newMediatorMetrics(m metrics.Metrics) *mediatorMetrics {
+	return &mediatorMetrics{
+		commandsDispatched: m.Counter("conqueress_commands_dispatched_total",
+			"Commands accepted for handling.", "command_type"),
+		commandsFailed: m.Counter("conqueress_commands_failed_total",
+			"Commands that were rejected or whose handler returned an error.", "command_type"),
+		handlerDuration: m.Histogram("conqueress_command_handler_duration_seconds",
+			"Time spent in command handlers.", "command_type"),
+		queueDepth: m.Gauge("conqueress_command_queue_depth",
+			"Commands waiting in the queue across all partitions."),
+		processorDuration: m.Histogram("conqueress_event_processor_duration_seconds",
+			"Time taken to deliver an event to a processor, including retries.", "event_type", "processor"),
+		processorFailures: m.Counter("conqueress_event_processor_failures_total",
+			"Events a processor failed on after using up its retries.", "event_type", "processor"),
+	}
+}
+
+func (m *Mediator) countDispatched(cmd Command) {
+	m.instruments.commandsDispatched.Add(1, reflect.TypeOf(cmd).String())
+}
+
+func (m *Mediator) countFailed(cmd Command) {
+	m.instruments.commandsFailed.Add(1, reflect.TypeOf(cmd).String())
+}
+
+func (m *Mediator) observeHandler(cmd Command, started time.Time) {
+	m.instruments.handlerDuration.Observe(time.Since(started).Seconds(), reflect.TypeOf(cmd).String())
+}
+
+func (m *Mediator) observeQueueDepth() {
+	m.instruments.queueDepth.Set(float64(m.QueueDepth()))
+}
+
+func (m *Mediator) observeDelivery(evt Event, r *processorRegistration, started time.Time) {
+	m.instruments.processorDuration.Observe(time.Since(started).Seconds(), reflect.TypeOf(evt).String(), r.name)
+}
+
+func (m *Mediator) countProcessorFailure(evt Event, r *processorRegistration) {
+	m.instruments.processorFailures.Add(1, reflect.TypeOf(evt).String(), r.name)
+}
@@ -0,0 +1,70 @@
+// Package metrics is the small metrics interface the mediator, repositories
+// and event stores report through. It has a no-op implementation, which is
+// the default, and a registry that serves what it records in the Prometheus
+// text exposition format.
+package metrics
+
+import "sync/atomic"
+
+// Metrics creates instruments. Asking again for an instrument with the same
+// name returns one that records into the same series. The label values
+// passed when recording must match the label names the instrument was
+// created with, in number and order.
+type Metrics interface {
+	Counter(name, help string, labels ...string) Counter
+	Gauge(name, help string, labels ...string) Gauge
+	Histogram(name, help string, labels ...string) Histogram
+}
+
+// Counter is a value that only goes up, such as a number of commands.
+type Counter interface {
+	Add(delta float64, labelValues ...string)
+}
+
+// Gauge is a value that goes up and down, such as a queue depth.
+type Gauge interface {
+	Set(value float64, labelValues ...string)
+}
+
+// Histogram records the distribution of observations, such as latencies in
+// seconds.
+type Histogram interface {
+	Observe(value float64, labelValues ...string)
+}
+
+type holder struct {
+	metrics Metrics
+}
+
+var defaultMetrics atomic.Pointer[holder]
+
+func init() {
+	defaultMetrics.Store(&holder{Noop()})
+}
+
+// Default returns the Metrics that code without a Metrics of its own reports
+// to. It is a no-op until SetDefault is called.
+func Default() Metrics {
+	return defaultMetrics.Load().metrics
+}
+
+// SetDefault replaces the default Metrics. Instruments already created from
+// the old default keep recording there, so call it before creating the
+// mediator and stores.
+func SetDefault(m Metrics) {
+	defaultMetrics.Store(&holder{m})
+}
+
+type noop struct{}
+
+// Noop returns a Metrics whose instruments discard everything.
+func Noop() Metrics {
+	return noop{}
+}
+
+func (noop) Counter(string, string, ...string) Counter     { return noop{} }
+func (noop) Gauge(string, string, ...string) Gauge         { return noop{} }
+func (noop) Histogram(string, string, ...string) Histogram { return noop{} }
+func (noop) Add(float64, ...string)                        {}
+func (noop) Set(float64, ...string)                        {}
+func (noop) Observe(float64, ...string)                    {}
@@ -0,0 +1,252 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram bucket upper bounds, in seconds, that
+// Prometheus clients use by default.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type kind string
+
+const (
+	counterKind   kind = "counter"
+	gaugeKind     kind = "gauge"
+	histogramKind kind = "histogram"
+)
+
+// Registry is a Metrics that keeps its series in memory and writes them in
+// the Prometheus text exposition format. It is an http.Handler, so it can be
+// mounted as the /metrics endpoint Prometheus scrapes. It is safe for
+// concurrent use.
+type Registry struct {
+	buckets []float64
+
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+type family struct {
+	name   string
+	help   string
+	kind   kind
+	labels []string
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64
+	count       uint64
+}
+
+// NewRegistry returns an empty registry whose histograms use buckets, or
+// DefaultBuckets if none are given.
+func NewRegistry(buckets ...float64) *Registry {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Registry{buckets: buckets, families: make(map[string]*family)}
+}
+
+func (r *Registry) Counter(name, help string, labels ...string) Counter {
+	return instrument{r, r.family(name, help, counterKind, labels)}
+}
+
+func (r *Registry) Gauge(name, help string, labels ...string) Gauge {
+	return instrument{r, r.family(name, help, gaugeKind, labels)}
+}
+
+func (r *Registry) Histogram(name, help string, labels ...string) Histogram {
+	return instrument{r, r.family(name, help, histogramKind, labels)}
+}
+
+// family returns the family called name, creating it if need be. Asking for
+// an existing name as a different kind of instrument, or with different
+// labels, is a programming error and panics.
+func (r *Registry) family(name, help string, k kind, labels []string) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f, ok := r.families[name]; ok {
+		if f.kind != k || strings.Join(f.labels, ",") != strings.Join(labels, ",") {
+			panic(fmt.Sprintf("metrics: %s is already registered as a %s with labels %v", name, f.kind, f.labels))
+		}
+		return f
+	}
+
+	f := &family{
+		name:   name,
+		help:   help,
+		kind:   k,
+		labels: append([]string(nil), labels...),
+		series: make(map[string]*series),
+	}
+	r.families[name] = f
+	return f
+}
+
+type instrument struct {
+	registry *Registry
+	family   *family
+}
+
+func (i instrument) Add(delta float64, labelValues ...string) {
+	i.registry.record(i.family, labelValues, func(s *series) {
+		s.value += delta
+	})
+}
+
+func (i instrument) Set(value float64, labelValues ...string) {
+	i.registry.record(i.family, labelValues, func(s *series) {
+		s.value = value
+	})
+}
+
+func (i instrument) Observe(value float64, labelValues ...string) {
+	buckets := i.registry.buckets
+	i.registry.record(i.family, labelValues, func(s *series) {
+		if s.counts == nil {
+			s.counts = make([]uint64, len(buckets))
+		}
+		for b, bound := range buckets {
+			if value <= bound {
+				s.counts[b]++
+			}
+		}
+		s.value += value
+		s.count++
+	})
+}
+
+func (r *Registry) record(f *family, labelValues []string, update func(s *series)) {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes labels %v, got values %v", f.name, f.labels, labelValues))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		f.series[key] = s
+	}
+	update(s)
+}
+
+// WriteTo writes every series in the Prometheus text exposition format,
+// families in name order.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, name := range names {
+		f := r.families[name]
+		fmt.Fprintf(cw, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(cw, "# TYPE %s %s\n", f.name, f.kind)
+
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := f.series[key]
+			if f.kind != histogramKind {
+				fmt.Fprintf(cw, "%s%s %s\n", f.name, labelSet(f.labels, s.labelValues), formatFloat(s.value))
+				continue
+			}
+			for b, bound := range r.buckets {
+				fmt.Fprintf(cw, "%s_bucket%s %d\n", f.name, labelSet(append(f.labels, "le"), append(s.labelValues, formatFloat(bound))), s.counts[b])
+			}
+			fmt.Fprintf(cw, "%s_bucket%s %d\n", f.name, labelSet(append(f.labels, "le"), append(s.labelValues, "+Inf")), s.count)
+			fmt.Fprintf(cw, "%s_sum%s %s\n", f.name, labelSet(f.labels, s.labelValues), formatFloat(s.value))
+			fmt.Fprintf(cw, "%s_count%s %d\n", f.name, labelSet(f.labels, s.labelValues), s.count)
+		}
+	}
+
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+// ServeHTTP serves the registry's series to a Prometheus scrape.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = r.WriteTo(w)
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+func labelSet(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabelValue(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func exposition(t *testing.T, r *Registry) string {
+	var b strings.Builder
+	_, err := r.WriteTo(&b)
+	require.Nil(t, err)
+	return b.String()
+}
+
+func TestRegistry(t *testing.T) {
+	var registry *Registry
+
+	ensure.That("counters and gauges are written in the Prometheus text format", func(s *ensure.Scenario) {
+		s.Given("a registry with a counter and a gauge", func() {
+			registry = NewRegistry()
+		})
+
+		s.When("I record values", func() {
+			c := registry.Counter("orders_total", "Orders placed.", "status")
+			c.Add(1, "paid")
+			c.Add(2, "paid")
+			c.Add(1, `say "hi"`)
+			registry.Gauge("queue_depth", "Items queued.").Set(7)
+		})
+
+		s.Then("each series should be written under its family", func() {
+			assert.Equal(t, `# HELP orders_total Orders placed.
+# TYPE orders_total counter
+orders_total{status="paid"} 3
+orders_total{status="say \"hi\""} 1
+# HELP queue_depth Items queued.
+# TYPE queue_depth gauge
+queue_depth 7
+`, exposition(t, registry))
+		})
+	}, t)
+
+	ensure.That("histograms write cumulative buckets, a sum and a count", func(s *ensure.Scenario) {
+		s.Given("a registry with two buckets", func() {
+			registry = NewRegistry(1, 0.1)
+		})
+
+		s.When("I observe values", func() {
+			h := registry.Histogram("latency_seconds", "Latency.", "op")
+			h.Observe(0.05, "save")
+			h.Observe(0.5, "save")
+			h.Observe(3, "save")
+		})
+
+		s.Then("the buckets should count every observation at or under their bound", func() {
+			assert.Equal(t, `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{op="save",le="0.1"} 1
+latency_seconds_bucket{op="save",le="1"} 2
+latency_seconds_bucket{op="save",le="+Inf"} 3
+latency_seconds_sum{op="save"} 3.55
+latency_seconds_count{op="save"} 3
+`, exposition(t, registry))
+		})
+	}, t)
+
+	ensure.That("asking for a family again records into the same series", func(s *ensure.Scenario) {
+		s.Given("a registry", func() {
+			registry = NewRegistry()
+		})
+
+		s.When("I add through two counters with the same name", func() {
+			registry.Counter("hits_total", "Hits.").Add(1)
+			registry.Counter("hits_total", "Hits.").Add(1)
+		})
+
+		s.Then("the series should hold both", func() {
+			assert.Contains(t, exposition(t, registry), "hits_total 2\n")
+		})
+
+		s.And("asking for it as another kind should panic", func() {
+			assert.Panics(t, func() { registry.Gauge("hits_total", "Hits.") })
+		})
+	}, t)
+}
@@ -0,0 +1,89 @@
+package conqueress
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/iamkoch/conqueress/metrics"
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	var (
+		registry *metrics.Registry
+		mediator *Mediator
+	)
+	setup := func() {
+		registry = metrics.NewRegistry()
+		mediator = NewMediator(false, WithMetrics(registry))
+	}
+	exposition := func() string {
+		var b strings.Builder
+		_, err := registry.WriteTo(&b)
+		require.Nil(t, err)
+		return b.String()
+	}
+
+	ensure.That("commands are counted and timed by type", func(s *ensure.Scenario) {
+		s.Given("a mediator reporting to a registry, with a handler that fails on empty names", func() {
+			setup()
+			_ = RegisterTypedCommandHandler(mediator, func(cmd createWidget) error {
+				if cmd.name == "" {
+					return errors.New("no name")
+				}
+				return nil
+			})
+		})
+
+		s.When("I dispatch one command that succeeds and one that fails", func() {
+			_ = mediator.DispatchSync(createWidget{"widget"}, nil)
+			_ = mediator.DispatchSync(createWidget{""}, nil)
+		})
+
+		s.Then("both should be counted as dispatched, and one as failed", func() {
+			out := exposition()
+			assert.Contains(t, out, `conqueress_commands_dispatched_total{command_type="conqueress.createWidget"} 2`)
+			assert.Contains(t, out, `conqueress_commands_failed_total{command_type="conqueress.createWidget"} 1`)
+			assert.Contains(t, out, `conqueress_command_handler_duration_seconds_count{command_type="conqueress.createWidget"} 2`)
+		})
+	}, t)
+
+	ensure.That("a command with no handler is counted as failed, not dispatched", func(s *ensure.Scenario) {
+		s.Given("a mediator without handlers", func() {
+			setup()
+		})
+
+		s.When("I dispatch a command", func() {
+			require.NotNil(t, mediator.Dispatch(createWidget{"widget"}, nil))
+		})
+
+		s.Then("it should be counted as failed", func() {
+			out := exposition()
+			assert.Contains(t, out, `conqueress_commands_failed_total{command_type="conqueress.createWidget"} 1`)
+			assert.NotContains(t, out, `conqueress_commands_dispatched_total{`)
+		})
+	}, t)
+
+	ensure.That("processors are timed, and counted when they give up", func(s *ensure.Scenario) {
+		s.Given("a mediator with a processor that always fails", func() {
+			setup()
+			_, _ = Subscribe(mediator, func(ctx context.Context, evt itemShipped) error {
+				return errors.New("broken")
+			}, WithProcessorName("shipping"))
+		})
+
+		s.When("I publish an event", func() {
+			require.NotNil(t, mediator.PublishSync(NewEvent[itemShipped]()))
+		})
+
+		s.Then("the delivery should be timed and the failure counted", func() {
+			out := exposition()
+			assert.Contains(t, out, `conqueress_event_processor_duration_seconds_count{event_type="conqueress.itemShipped",processor="shipping"} 1`)
+			assert.Contains(t, out, `conqueress_event_processor_failures_total{event_type="conqueress.itemShipped",processor="shipping"} 1`)
+		})
+	}, t)
+}
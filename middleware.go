@@ -0,0 +1,31 @@
+package conqueress
+
+// CommandMiddleware wraps the handler for a command. It can act before and
+// after calling next, change the context next receives, or return without
+// calling next at all to reject the command.
+type CommandMiddleware func(next ContextCommandHandler) ContextCommandHandler
+
+// EventMiddleware wraps a single event processor in the same way
+// CommandMiddleware wraps a command handler. It runs once for every processor
+// an event is delivered to.
+type EventMiddleware func(next ContextEventProcessor) ContextEventProcessor
+
+// Use appends middleware to the command pipeline. The first middleware added
+// is the outermost, so it sees the command first and the result last. The
+// pipeline applies to every command handler, including ones registered before
+// Use is called.
+func (m *Mediator) Use(middleware ...CommandMiddleware) {
+	_ = m.updateRegistry(func(r *registry) error {
+		r.commandMiddleware = append(r.commandMiddleware[:len(r.commandMiddleware):len(r.commandMiddleware)], middleware...)
+		return nil
+	})
+}
+
+// UseEvents appends middleware to the event pipeline, with the same ordering
+// as Use.
+func (m *Mediator) UseEvents(middleware ...EventMiddleware) {
+	_ = m.updateRegistry(func(r *registry) error {
+		r.eventMiddleware = append(r.eventMiddleware[:len(r.eventMiddleware):len(r.eventMiddleware)], middleware...)
+		return nil
+	})
+}
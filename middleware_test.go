@@ -0,0 +1,114 @@
+package conqueress
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandMiddleware(t *testing.T) {
+	var (
+		mediator *Mediator
+		handler  *TestCmdHandler
+		calls    []string
+		err      error
+	)
+	record := func(name string) CommandMiddleware {
+		return func(next ContextCommandHandler) ContextCommandHandler {
+			return func(ctx context.Context, cmd Command) error {
+				calls = append(calls, name+" before")
+				e := next(ctx, cmd)
+				calls = append(calls, name+" after")
+				return e
+			}
+		}
+	}
+	ensure.That("command middleware wraps handlers in the order it is added", func(s *ensure.Scenario) {
+		s.Given("a mediator with a command handler", func() {
+			mediator = NewMediator(false)
+			handler = &TestCmdHandler{}
+			_ = RegisterCommandHandler[TestCmd](mediator, handler.Handle)
+		})
+
+		s.And("two middleware added after the handler", func() {
+			mediator.Use(record("outer"), record("inner"))
+		})
+
+		s.When("I dispatch a command synchronously", func() {
+			err = mediator.DispatchSync(TestCmd{}, nil)
+		})
+
+		s.Then("the middleware should run around the handler", func() {
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"outer before", "inner before", "inner after", "outer after"}, calls)
+			assert.Len(t, handler.Received(), 1)
+		})
+	}, t)
+}
+
+func TestCommandMiddlewareCanReject(t *testing.T) {
+	var (
+		mediator *Mediator
+		handler  *TestCmdHandler
+		rejected = errors.New("not allowed")
+		err      error
+	)
+	ensure.That("middleware that does not call next stops the command", func(s *ensure.Scenario) {
+		s.Given("a mediator with a rejecting middleware", func() {
+			mediator = NewMediator(false)
+			handler = &TestCmdHandler{}
+			_ = RegisterCommandHandler[TestCmd](mediator, handler.Handle)
+			mediator.Use(func(next ContextCommandHandler) ContextCommandHandler {
+				return func(ctx context.Context, cmd Command) error {
+					return rejected
+				}
+			})
+		})
+
+		s.When("I dispatch a command", func() {
+			resp := make(chan CommandProcessingError, 1)
+			_ = mediator.Dispatch(TestCmd{}, resp)
+			err = <-resp
+		})
+
+		s.Then("the middleware's error should come back and the handler should not run", func() {
+			assert.ErrorIs(t, err, rejected)
+			assert.Empty(t, handler.Received())
+		})
+	}, t)
+}
+
+func TestEventMiddleware(t *testing.T) {
+	var (
+		mediator *Mediator
+		handler1 = &TestEvtHandler{}
+		handler2 = &TestEvtHandler{}
+		wrapped  int
+	)
+	ensure.That("event middleware runs once per processor", func(s *ensure.Scenario) {
+		s.Given("a mediator with two processors and an event middleware", func() {
+			mediator = NewMediator(false)
+			_ = mediator.RegisterEventHandler(reflectTypeOf[TestEvent](), handler1.Handle, WithProcessorName("handler1"))
+			_ = mediator.RegisterEventHandler(reflectTypeOf[TestEvent](), handler2.Handle, WithProcessorName("handler2"))
+			mediator.UseEvents(func(next ContextEventProcessor) ContextEventProcessor {
+				return func(ctx context.Context, evt Event) error {
+					wrapped++
+					return next(ctx, evt)
+				}
+			})
+		})
+
+		s.When("I publish an event synchronously", func() {
+			_ = mediator.PublishSync(TestEvent{})
+		})
+
+		s.Then("the middleware should have wrapped both processors", func() {
+			assert.Equal(t, 2, wrapped)
+			assert.Len(t, handler1.Received(), 1)
+			assert.Len(t, handler2.Received(), 1)
+		})
+	}, t)
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	cqrs "github.com/iamkoch/conqueress"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type dbProcessedCommand struct {
+	Key         string    `bson:"_id"`
+	CommandId   string    `bson:"command_id"`
+	CommandType string    `bson:"command_type"`
+	Result      []byte    `bson:"result"`
+	ProcessedAt time.Time `bson:"processed_at"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+type mongoDeduplicationStore struct {
+	client *mongo.Client
+}
+
+// NewMongoDeduplicationStore returns a cqrs.DeduplicationStore that keeps
+// processed commands in the processed_commands collection, one document per
+// command type and ID. It creates a TTL
+// index on expires_at, so MongoDB deletes records once their window has
+// passed. The TTL monitor runs about once a minute, so Get also ignores
+// records that have expired but not yet been deleted.
+func NewMongoDeduplicationStore(cs ConnectionString) (cqrs.DeduplicationStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(string(cs)))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &mongoDeduplicationStore{client}
+	_, err = s.collection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *mongoDeduplicationStore) collection() *mongo.Collection {
+	return s.client.Database("devly").Collection("processed_commands")
+}
+
+// processedCommandKey is the ID of the document recording a command. Type
+// names have no colons, so no two commands share one.
+func processedCommandKey(commandType, commandID string) string {
+	return commandType + ":" + commandID
+}
+
+func (s *mongoDeduplicationStore) Get(ctx context.Context, commandType, commandID string) (*cqrs.ProcessedCommand, error) {
+	var record dbProcessedCommand
+	err := s.collection().FindOne(ctx, bson.M{
+		"_id":        processedCommandKey(commandType, commandID),
+		"expires_at": bson.M{"$gt": time.Now().UTC()},
+	}).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &cqrs.ProcessedCommand{
+		CommandID:   record.CommandId,
+		CommandType: record.CommandType,
+		Result:      record.Result,
+		ProcessedAt: record.ProcessedAt,
+		ExpiresAt:   record.ExpiresAt,
+	}, nil
+}
+
+func (s *mongoDeduplicationStore) Put(ctx context.Context, record cqrs.ProcessedCommand) error {
+	key := processedCommandKey(record.CommandType, record.CommandID)
+	_, err := s.collection().ReplaceOne(ctx,
+		bson.M{"_id": key},
+		dbProcessedCommand{
+			Key:         key,
+			CommandId:   record.CommandID,
+			CommandType: record.CommandType,
+			Result:      record.Result,
+			ProcessedAt: record.ProcessedAt,
+			ExpiresAt:   record.ExpiresAt,
+		},
+		options.Replace().SetUpsert(true))
+	return err
+}
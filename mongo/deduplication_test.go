@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cqrs "github.com/iamkoch/conqueress"
+	"github.com/iamkoch/conqueress/guid"
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeduplicationStore(t *testing.T) {
+	var (
+		ds     cqrs.DeduplicationStore
+		id     = guid.New().String()
+		record *cqrs.ProcessedCommand
+		err    error
+	)
+	ensure.That("processed commands are remembered until they expire", func(s *ensure.Scenario) {
+		s.Background("Given an available mongo deduplication store", func() {
+			ds, err = NewMongoDeduplicationStore(connectionString(t))
+			require.Nil(t, err)
+		})
+
+		s.When("I record a processed command", func() {
+			now := time.Now().UTC()
+			require.Nil(t, ds.Put(context.Background(), cqrs.ProcessedCommand{
+				CommandID:   id,
+				CommandType: "placeOrder",
+				Result:      []byte(`{"AggregateId":"widget"}`),
+				ProcessedAt: now,
+				ExpiresAt:   now.Add(time.Minute),
+			}))
+			record, err = ds.Get(context.Background(), "placeOrder", id)
+		})
+
+		s.Then("it should be returned", func() {
+			require.Nil(t, err)
+			require.NotNil(t, record)
+			assert.Equal(t, []byte(`{"AggregateId":"widget"}`), record.Result)
+		})
+
+		s.And("a command of another type with the same ID should not be", func() {
+			record, err = ds.Get(context.Background(), "cancelOrder", id)
+			assert.Nil(t, err)
+			assert.Nil(t, record)
+		})
+
+		s.And("an unknown command should not be", func() {
+			record, err = ds.Get(context.Background(), "placeOrder", guid.New().String())
+			assert.Nil(t, err)
+			assert.Nil(t, record)
+		})
+	}, t)
+}
+
+func TestDeduplicationStoreExpiry(t *testing.T) {
+	var (
+		ds     cqrs.DeduplicationStore
+		id     = guid.New().String()
+		record *cqrs.ProcessedCommand
+		err    error
+	)
+	ensure.That("expired commands are ignored before mongo deletes them", func(s *ensure.Scenario) {
+		s.Background("Given an available mongo deduplication store", func() {
+			ds, err = NewMongoDeduplicationStore(connectionString(t))
+			require.Nil(t, err)
+		})
+
+		s.When("I record a processed command whose window has passed", func() {
+			now := time.Now().UTC()
+			require.Nil(t, ds.Put(context.Background(), cqrs.ProcessedCommand{
+				CommandID:   id,
+				CommandType: "placeOrder",
+				ProcessedAt: now.Add(-2 * time.Minute),
+				ExpiresAt:   now.Add(-time.Minute),
+			}))
+			record, err = ds.Get(context.Background(), "placeOrder", id)
+		})
+
+		s.Then("it should not be returned", func() {
+			assert.Nil(t, err)
+			assert.Nil(t, record)
+		})
+	}, t)
+}
@@ -0,0 +1,17 @@
+package store
+
+import (
+	"os"
+	"testing"
+)
+
+// connectionString returns the MongoDB the tests run against, taken from
+// MONGODB_URI, and skips the test when it is not set. Saves run in
+// transactions, so it must be a replica set.
+func connectionString(t *testing.T) ConnectionString {
+	cs := os.Getenv("MONGODB_URI")
+	if cs == "" {
+		t.Skip("MONGODB_URI is not set")
+	}
+	return ConnectionString(cs)
+}
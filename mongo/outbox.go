@@ -0,0 +1,151 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	cqrs "github.com/iamkoch/conqueress"
+	"github.com/iamkoch/conqueress/eventstore"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// dbOutboxEntry is an event in the outbox collection, keyed by the event's ID.
+// SaveEvents writes one for each event in the same transaction as the event.
+type dbOutboxEntry struct {
+	Key          string `bson:"_id"`
+	dbEvent      `bson:",inline"`
+	Dispatched   bool      `bson:"dispatched"`
+	DispatchedAt time.Time `bson:"dispatched_at,omitempty"`
+	LeaseUntil   time.Time `bson:"lease_until"`
+	Attempts     int       `bson:"attempts"`
+}
+
+type mongoOutbox struct {
+	client *mongo.Client
+	tm     *TypeMap
+}
+
+// NewMongoOutbox returns the outbox the Mongo event store writes to, for an
+// eventstore.OutboxRelay to publish from. Every event type the store saves
+// must be added to tm.
+func NewMongoOutbox(cs ConnectionString, tm *TypeMap) (eventstore.Outbox, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(string(cs)))
+	if err != nil {
+		return nil, err
+	}
+
+	o := &mongoOutbox{client, tm}
+	_, err = o.collection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "dispatched", Value: 1}, {Key: "position", Value: 1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+func (o *mongoOutbox) collection() *mongo.Collection {
+	return outboxCollection(o.client)
+}
+
+func outboxCollection(client *mongo.Client) *mongo.Collection {
+	return client.Database("devly").Collection("outbox")
+}
+
+// Claim reads the oldest undispatched entries, then claims them one at a
+// time with findOneAndUpdate, which only matches an entry whose lease has run
+// out, so concurrent relays never claim the same entry. It stops at the first
+// entry that is leased, whether it was when read or was claimed by another
+// relay since, so entries are never claimed ahead of an older one.
+func (o *mongoOutbox) Claim(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]eventstore.OutboxEntry, error) {
+	claimed := make([]eventstore.OutboxEntry, 0)
+	cur, err := o.collection().Find(ctx,
+		bson.M{"dispatched": false},
+		options.Find().SetSort(bson.D{{Key: "position", Value: 1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return claimed, err
+	}
+	var pending []dbOutboxEntry
+	if err = cur.All(ctx, &pending); err != nil {
+		return claimed, err
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	for _, p := range pending {
+		if p.LeaseUntil.After(now) {
+			break
+		}
+
+		var dbo dbOutboxEntry
+		err := o.collection().FindOneAndUpdate(ctx,
+			bson.M{"_id": p.Key, "dispatched": false, "lease_until": bson.M{"$lte": now}},
+			bson.M{
+				"$set": bson.M{"lease_until": now.Add(lease)},
+				"$inc": bson.M{"attempts": 1},
+			},
+			opts).Decode(&dbo)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return claimed, err
+		}
+
+		evt, err := o.toEvent(&dbo)
+		if err != nil {
+			if err = o.deadLetter(ctx, &dbo, err); err != nil {
+				return claimed, err
+			}
+			continue
+		}
+		claimed = append(claimed, eventstore.OutboxEntry{
+			Id:       dbo.Key,
+			Event:    evt,
+			Attempts: dbo.Attempts,
+		})
+	}
+
+	return claimed, nil
+}
+
+// deadLetter moves an entry whose event cannot be decoded, because its type is
+// not in the type map or its body does not fit it, to the outbox_dead
+// collection, so it does not hold back the entries behind it.
+func (o *mongoOutbox) deadLetter(ctx context.Context, dbo *dbOutboxEntry, cause error) error {
+	slog.With(
+		"id", dbo.Key,
+		"type", dbo.Type,
+		"error", cause,
+	).Error("Dead-lettering outbox entry that cannot be decoded")
+
+	dead := o.client.Database("devly").Collection("outbox_dead")
+	_, err := dead.ReplaceOne(ctx, bson.M{"_id": dbo.Key}, dbo, options.Replace().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	_, err = o.collection().DeleteOne(ctx, bson.M{"_id": dbo.Key})
+	return err
+}
+
+func (o *mongoOutbox) toEvent(dbo *dbOutboxEntry) (cqrs.Event, error) {
+	t, err := o.tm.Get(dbo.Type)
+	if err != nil {
+		return nil, err
+	}
+	return envelopeToEvent(t, &dbo.dbEvent)
+}
+
+func (o *mongoOutbox) MarkDispatched(ctx context.Context, id string) error {
+	_, err := o.collection().UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"dispatched": true, "dispatched_at": time.Now().UTC()}})
+	return err
+}
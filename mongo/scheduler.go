@@ -0,0 +1,172 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"reflect"
+	"time"
+
+	cqrs "github.com/iamkoch/conqueress"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type dbScheduledCommand struct {
+	Id            string    `bson:"_id"`
+	Type          string    `bson:"type"`
+	Body          string    `bson:"body"`
+	DueAt         time.Time `bson:"due_at"`
+	Attempts      int       `bson:"attempts"`
+	CorrelationId string    `bson:"correlation_id"`
+	CausationId   string    `bson:"causation_id"`
+}
+
+type mongoCommandScheduler struct {
+	client *mongo.Client
+	tm     *TypeMap
+}
+
+// NewMongoCommandScheduler returns a cqrs.CommandScheduler that keeps
+// scheduled commands in the scheduled_commands collection, so they survive
+// restarts. Commands are stored as JSON, so only their exported fields are
+// kept, and every scheduled command type must be added to tm.
+func NewMongoCommandScheduler(cs ConnectionString, tm *TypeMap) (cqrs.CommandScheduler, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(string(cs)))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &mongoCommandScheduler{client, tm}
+	_, err = s.collection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "due_at", Value: 1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *mongoCommandScheduler) collection() *mongo.Collection {
+	return s.client.Database("devly").Collection("scheduled_commands")
+}
+
+func (s *mongoCommandScheduler) Schedule(ctx context.Context, cmd cqrs.ScheduledCommand) error {
+	body, err := json.Marshal(cmd.Command)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.collection().InsertOne(ctx, dbScheduledCommand{
+		Id:            cmd.Id,
+		Type:          reflect.TypeOf(cmd.Command).Name(),
+		Body:          string(body),
+		DueAt:         cmd.DueAt,
+		Attempts:      cmd.Attempts,
+		CorrelationId: cmd.CorrelationId,
+		CausationId:   cmd.CausationId,
+	})
+	return err
+}
+
+func (s *mongoCommandScheduler) Cancel(ctx context.Context, id string) error {
+	res, err := s.collection().DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return cqrs.ErrScheduledCommandNotFound
+	}
+	return nil
+}
+
+// Due claims commands one at a time with findOneAndUpdate, so concurrent
+// pollers never claim the same command. It reads each command as it was
+// before the claim, so the DueAt it returns is the time the command was
+// scheduled for rather than the end of its lease, as in the other schedulers.
+func (s *mongoCommandScheduler) Due(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]cqrs.ScheduledCommand, error) {
+	due := make([]cqrs.ScheduledCommand, 0)
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "due_at", Value: 1}}).
+		SetReturnDocument(options.Before)
+
+	for len(due) < limit {
+		var dbc dbScheduledCommand
+		err := s.collection().FindOneAndUpdate(ctx,
+			bson.M{"due_at": bson.M{"$lte": now}},
+			bson.M{
+				"$set": bson.M{"due_at": now.Add(lease)},
+				"$inc": bson.M{"attempts": 1},
+			},
+			opts).Decode(&dbc)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return due, err
+		}
+		dbc.Attempts++
+
+		cmd, err := s.toCommand(&dbc)
+		if err != nil {
+			if err = s.deadLetter(ctx, &dbc, err); err != nil {
+				return due, err
+			}
+			continue
+		}
+		due = append(due, cqrs.ScheduledCommand{
+			Id:            dbc.Id,
+			Command:       cmd,
+			DueAt:         dbc.DueAt,
+			Attempts:      dbc.Attempts,
+			CorrelationId: dbc.CorrelationId,
+			CausationId:   dbc.CausationId,
+		})
+	}
+
+	return due, nil
+}
+
+// deadLetter moves a command that cannot be decoded, because its type is not
+// in the type map or its body does not fit it, to the
+// scheduled_commands_dead collection, so it does not hold back the commands
+// behind it.
+func (s *mongoCommandScheduler) deadLetter(ctx context.Context, dbc *dbScheduledCommand, cause error) error {
+	slog.With(
+		"id", dbc.Id,
+		"type", dbc.Type,
+		"error", cause,
+	).Error("Dead-lettering scheduled command that cannot be decoded")
+
+	dead := s.client.Database("devly").Collection("scheduled_commands_dead")
+	_, err := dead.ReplaceOne(ctx, bson.M{"_id": dbc.Id}, dbc, options.Replace().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	_, err = s.collection().DeleteOne(ctx, bson.M{"_id": dbc.Id})
+	return err
+}
+
+func (s *mongoCommandScheduler) Complete(ctx context.Context, id string) error {
+	_, err := s.collection().DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (s *mongoCommandScheduler) toCommand(dbc *dbScheduledCommand) (cqrs.Command, error) {
+	t, err := s.tm.Get(dbc.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	v := reflect.New(t)
+	if err = json.Unmarshal([]byte(dbc.Body), v.Interface()); err != nil {
+		return nil, err
+	}
+	return v.Elem().Interface(), nil
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/iamkoch/conqueress/eventstore"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type dbSnapshot struct {
+	Id            string    `bson:"_id"`
+	AggregateId   string    `bson:"aggregate_id"`
+	AggregateType string    `bson:"aggregate_type"`
+	Version       int       `bson:"version"`
+	Schema        int       `bson:"schema"`
+	Data          []byte    `bson:"data"`
+	TakenAt       time.Time `bson:"taken_at"`
+}
+
+type mongoSnapshotStore struct {
+	client *mongo.Client
+}
+
+// NewMongoSnapshotStore returns an eventstore.SnapshotStore that keeps
+// snapshots in the snapshots collection, one document per aggregate and
+// version.
+func NewMongoSnapshotStore(cs ConnectionString) (eventstore.SnapshotStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(string(cs)))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &mongoSnapshotStore{client}
+	_, err = s.collection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "aggregate_id", Value: 1}, {Key: "version", Value: -1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *mongoSnapshotStore) collection() *mongo.Collection {
+	return s.client.Database("devly").Collection("snapshots")
+}
+
+func (s *mongoSnapshotStore) SaveSnapshot(ctx context.Context, snapshot eventstore.Snapshot) error {
+	id := fmt.Sprintf("%s:%d", snapshot.AggregateId, snapshot.Version)
+	_, err := s.collection().ReplaceOne(ctx, bson.M{"_id": id}, dbSnapshot{
+		Id:            id,
+		AggregateId:   snapshot.AggregateId,
+		AggregateType: snapshot.AggregateType,
+		Version:       snapshot.Version,
+		Schema:        snapshot.Schema,
+		Data:          snapshot.Data,
+		TakenAt:       snapshot.TakenAt,
+	}, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *mongoSnapshotStore) LatestSnapshot(ctx context.Context, aggregateId string) (eventstore.Snapshot, error) {
+	var dbs dbSnapshot
+	err := s.collection().FindOne(ctx,
+		bson.M{"aggregate_id": aggregateId},
+		options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})).Decode(&dbs)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return eventstore.Snapshot{}, eventstore.ErrSnapshotNotFound
+	}
+	if err != nil {
+		return eventstore.Snapshot{}, err
+	}
+	return eventstore.Snapshot{
+		AggregateId:   dbs.AggregateId,
+		AggregateType: dbs.AggregateType,
+		Version:       dbs.Version,
+		Schema:        dbs.Schema,
+		Data:          dbs.Data,
+		TakenAt:       dbs.TakenAt.UTC(),
+	}, nil
+}
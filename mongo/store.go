@@ -3,7 +3,6 @@ package store
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	cqrs "github.com/iamkoch/conqueress"
 	"github.com/iamkoch/conqueress/eventstore"
@@ -13,21 +12,19 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readconcern"
 	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"reflect"
 	"time"
 )
 
-type simpleEnvelope struct {
-	Id            guid.Guid `bson:"_id"`
-	CorrelationId guid.Guid `bson:"correlation_id"`
-	CausationId   guid.Guid `bson:"causation_id"`
-}
+var tracer = otel.Tracer("github.com/iamkoch/conqueress/mongo")
 
-type envelope struct {
-	simpleEnvelope
-	Type        string `bson:"type"`
-	Body        string `bson:"body"`
-	AggregateId string `bson:"aggregate_id"`
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		append(attrs, attribute.String("db.system", "mongodb"))...,
+	))
 }
 
 type mongoEventStore struct {
@@ -46,14 +43,32 @@ func NewMongoEventStore(cs ConnectionString, tm *TypeMap) (eventstore.IEventStor
 		return nil, err
 	}
 
+	// ReadAll reads events by position, and the stream reads by aggregate or
+	// event type and then position. Events saved before positions were
+	// assigned have none, so those indexes cannot be unique. The version
+	// range reads use the index on aggregate and version.
+	_, err = client.Database("devly").Collection("events").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "aggregate_id", Value: 1}, {Key: "version", Value: 1}}},
+		{Keys: bson.D{{Key: "position", Value: 1}}},
+		{Keys: bson.D{{Key: "aggregate_type", Value: 1}, {Key: "position", Value: 1}}},
+		{Keys: bson.D{{Key: "type", Value: 1}, {Key: "position", Value: 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return &mongoEventStore{client, tm}, nil
 }
 
+// checkConcurrency fails with eventstore.ErrConcurrencyException unless the
+// aggregate is at expectedVersion, where -1 means it must not exist yet.
 func checkConcurrency(expectedVersion int, a *dbAggregate) error {
-	isNewAggregate := expectedVersion == -1
-	hasVersionMismatch := a.Version != expectedVersion
-	if hasVersionMismatch && !isNewAggregate {
-		return errors.New("concurrency error")
+	current := a.Version
+	if a.IsNew {
+		current = -1
+	}
+	if current != expectedVersion {
+		return fmt.Errorf("%w: %d != %d", eventstore.ErrConcurrencyException, current, expectedVersion)
 	}
 	return nil
 }
@@ -82,78 +97,93 @@ func tryGetExistingAggregate(
 }
 
 func (m mongoEventStore) SaveEvents(aggregateType string, aggregateId guid.Guid, events []cqrs.Event, expectedVersion int) error {
+	return m.SaveEventsContext(context.Background(), aggregateType, aggregateId, events, expectedVersion)
+}
+
+func (m mongoEventStore) SaveEventsContext(ctx context.Context, aggregateType string, aggregateId guid.Guid, events []cqrs.Event, expectedVersion int) (err error) {
+	ctx, span := startSpan(ctx, "SaveEvents",
+		eventstore.AggregateTypeKey.String(aggregateType),
+		eventstore.AggregateIdKey.String(aggregateId.String()),
+		eventstore.EventCountKey.Int(len(events)))
+	defer func() { eventstore.EndSpan(span, err) }()
+	defer eventstore.ObserveTransaction("mongodb", "SaveEvents", time.Now())
+
 	ec := m.client.Database("devly").Collection("events")
 	ac := m.client.Database("devly").Collection("aggregates")
+	ox := outboxCollection(m.client)
 
 	session, err := m.client.StartSession()
 	if err != nil {
 		return err
 	}
-	defer session.EndSession(context.Background())
+	defer session.EndSession(ctx)
 
 	wc := writeconcern.New(writeconcern.WMajority())
 	rc := readconcern.Snapshot()
 	txnOpts := options.Transaction().SetWriteConcern(wc).SetReadConcern(rc)
 
-	err = mongo.WithSession(context.Background(), session, func(sessionContext mongo.SessionContext) error {
-		if err = session.StartTransaction(txnOpts); err != nil {
-			return err
-		}
-
+	// WithTransaction runs the callback again when the transaction fails with
+	// a transient error, such as a write conflict with a concurrent save on
+	// the events counter, or when its commit result is unknown.
+	_, err = session.WithTransaction(ctx, func(sessionContext mongo.SessionContext) (interface{}, error) {
 		getDefaultAggregate := func() *dbAggregate {
-			return &dbAggregate{Id: aggregateId.String(), Version: 0}
+			return &dbAggregate{Id: aggregateId.String(), IsNew: true}
 		}
 
 		dbAgg, e := tryGetExistingAggregate(sessionContext, ac, aggregateId, getDefaultAggregate)
-
 		if e != nil {
-			return e
+			return nil, e
 		}
 
-		e = checkConcurrency(expectedVersion, dbAgg)
+		if e = checkConcurrency(expectedVersion, dbAgg); e != nil {
+			eventstore.CountConcurrencyConflict(aggregateType)
+			return nil, e
+		}
 
+		position, e := reservePositions(sessionContext, m.client.Database("devly").Collection("counters"), len(events))
 		if e != nil {
-			fmt.Println("concurrency error")
-			return e
+			return nil, e
 		}
 
 		ev := expectedVersion
+		recordedAt := time.Now().UTC()
 
 		for _, event := range events {
 			ev++
-			dbe, e := createDbEvent(event, aggregateType, guid.New(), guid.New(), aggregateId, ev)
+			position++
+			md := eventstore.Record(event, aggregateType, aggregateId.String(), ev, position, recordedAt)
+			dbe, e := createDbEvent(event, md)
 			if e != nil {
-				return e
+				return nil, e
 			}
 
-			_, e = ec.InsertOne(sessionContext, dbe)
+			if _, e = ec.InsertOne(sessionContext, dbe); e != nil {
+				return nil, e
+			}
 
-			if e != nil {
-				fmt.Println("Error saving event ", e)
-				return e
+			if _, e = ox.InsertOne(sessionContext, dbOutboxEntry{Key: dbe.Id, dbEvent: *dbe}); e != nil {
+				return nil, e
 			}
 		}
 
 		_, e = ac.UpdateOne(sessionContext, bson.M{"_id": aggregateId.String()}, bson.M{"$set": bson.M{"version": ev}}, options.Update().SetUpsert(true))
-
-		if err = session.CommitTransaction(sessionContext); err != nil {
-			return err
-		}
-		return nil
-	})
-
-	if err != nil {
-		fmt.Printf("Error calling transaction %s\n", err.Error())
-		return err
-	} else {
-		fmt.Printf("Transaction successful\n")
-	}
-	return nil
+		return nil, e
+	}, txnOpts)
+	return err
 }
 
 func (m mongoEventStore) GetEventsForAggregate(aggregateId guid.Guid) []cqrs.Event {
+	return m.GetEventsForAggregateContext(context.Background(), aggregateId)
+}
+
+func (m mongoEventStore) GetEventsForAggregateContext(ctx context.Context, aggregateId guid.Guid) []cqrs.Event {
+	ctx, span := startSpan(ctx, "GetEventsForAggregate",
+		eventstore.AggregateIdKey.String(aggregateId.String()))
+	defer span.End()
+	defer eventstore.ObserveTransaction("mongodb", "GetEventsForAggregate", time.Now())
+
 	ec := m.client.Database("devly").Collection("events")
-	c, e := ec.Find(context.Background(), bson.M{"aggregate_id": aggregateId.String()})
+	c, e := ec.Find(ctx, bson.M{"aggregate_id": aggregateId.String()})
 	if e != nil {
 		//if e.Error() == mongo.ErrNoDocuments {
 		//	return []cqrs.Event{}
@@ -161,19 +191,19 @@ func (m mongoEventStore) GetEventsForAggregate(aggregateId guid.Guid) []cqrs.Eve
 		panic(e.Error())
 	}
 
-	var results []envelope
-	if err := c.All(context.TODO(), &results); err != nil {
+	var results []dbEvent
+	if err := c.All(ctx, &results); err != nil {
 		panic(err)
 	}
 
 	events := make([]cqrs.Event, 0)
-	for _, envelope := range results {
-		get, e := m.tm.Get(envelope.Type)
+	for _, dbe := range results {
+		get, e := m.tm.Get(dbe.Type)
 		if e != nil {
 			fmt.Println("Error getting event ", e)
 			panic("couldn't get event")
 		}
-		ev, err := envelopeToEvent(get, &envelope)
+		ev, err := envelopeToEvent(get, &dbe)
 		if err != nil {
 			fmt.Println("Error getting event ", err)
 			panic("couldn't get event")
@@ -184,16 +214,20 @@ func (m mongoEventStore) GetEventsForAggregate(aggregateId guid.Guid) []cqrs.Eve
 	return events
 }
 
-func envelopeToEvent(t reflect.Type, e *envelope) (cqrs.Event, error) {
+func envelopeToEvent(t reflect.Type, e *dbEvent) (cqrs.Event, error) {
 	v := reflect.New(t)
 
 	// reflected pointer
 	newP := v.Interface()
 
 	// Unmarshal to reflected struct pointer
-	json.Unmarshal([]byte(e.Body), newP)
+	if err := json.Unmarshal([]byte(e.Body), newP); err != nil {
+		return nil, err
+	}
 
-	return dereferenceIfPtr(newP).(cqrs.Event), nil
+	event := dereferenceIfPtr(newP).(cqrs.Event)
+	eventstore.Restore(event, e.metadata())
+	return event, nil
 }
 
 func dereferenceIfPtr(value interface{}) interface{} {
@@ -215,38 +249,80 @@ type dbEvent struct {
 	Body          string `bson:"body"`
 	Type          string `bson:"type"`
 	Version       int    `bson:"version"`
+	Position      int64  `bson:"position"`
 	Timestamp     int64  `bson:"timestamp"`
+	OccurredAt    int64  `bson:"occurred_at"`
+	RecordedAt    int64  `bson:"recorded_at"`
 	CorrelationId string `bson:"correlation_id"`
 	CausationId   string `bson:"causation_id"`
+	UserId        string `bson:"user_id"`
+	TenantId      string `bson:"tenant_id"`
+}
+
+// metadata returns the metadata stored alongside the event. The times are
+// stored as Unix nanoseconds, because BSON dates only keep milliseconds.
+func (e *dbEvent) metadata() cqrs.Metadata {
+	return cqrs.Metadata{
+		OccurredAt:    time.Unix(0, e.OccurredAt).UTC(),
+		RecordedAt:    time.Unix(0, e.RecordedAt).UTC(),
+		AggregateId:   e.AggregateId,
+		AggregateType: e.AggregateType,
+		Version:       e.Version,
+		Position:      e.Position,
+		CorrelationId: e.CorrelationId,
+		CausationId:   e.CausationId,
+		UserId:        e.UserId,
+		TenantId:      e.TenantId,
+	}
 }
 
 type dbAggregate struct {
 	Id      string `bson:"_id"`
 	Version int    `bson:"version"`
+	IsNew   bool   `bson:"-"`
 }
 
-func createDbEvent(
-	e cqrs.Event,
-	aggName string,
-	cor guid.Guid,
-	cau guid.Guid,
-	aid guid.Guid,
-	v int) (*dbEvent, error) {
+func createDbEvent(e cqrs.Event, md cqrs.Metadata) (*dbEvent, error) {
 	bytes, err := json.Marshal(e)
 	if err != nil {
-		fmt.Println(err)
 		return nil, err
 	}
 
 	return &dbEvent{
 		Id:            e.MsgId().String(),
-		AggregateId:   aid.String(),
-		AggregateType: aggName,
+		AggregateId:   md.AggregateId,
+		AggregateType: md.AggregateType,
 		Body:          string(bytes),
 		Type:          reflect.TypeOf(e).Name(),
-		Version:       v,
-		Timestamp:     time.Now().UTC().Unix(),
-		CorrelationId: cor.String(),
-		CausationId:   cau.String(),
+		Version:       md.Version,
+		Position:      md.Position,
+		Timestamp:     md.RecordedAt.Unix(),
+		OccurredAt:    md.OccurredAt.UnixNano(),
+		RecordedAt:    md.RecordedAt.UnixNano(),
+		CorrelationId: md.CorrelationId,
+		CausationId:   md.CausationId,
+		UserId:        md.UserId,
+		TenantId:      md.TenantId,
 	}, nil
 }
+
+// reservePositions claims the next n global positions from the events
+// counter, inside the save's transaction, and returns the position before
+// the first of them. Every save updates the same counter document, so
+// concurrent saves, even to different aggregates, conflict on it, and all
+// but one are aborted and retried by WithTransaction. A save that commits has
+// positions no other save has, with no gaps left by the saves that retried.
+func reservePositions(ctx mongo.SessionContext, counters *mongo.Collection, n int) (int64, error) {
+	var counter struct {
+		Position int64 `bson:"position"`
+	}
+	err := counters.FindOneAndUpdate(ctx,
+		bson.M{"_id": "events"},
+		bson.M{"$inc": bson.M{"position": n}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return 0, err
+	}
+	return counter.Position - int64(n), nil
+}
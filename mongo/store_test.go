@@ -0,0 +1,96 @@
+package store
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	cqrs "github.com/iamkoch/conqueress"
+	"github.com/iamkoch/conqueress/eventstore"
+	"github.com/iamkoch/conqueress/guid"
+	"github.com/iamkoch/conqueress/sample_domain"
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentSaves(t *testing.T) {
+	const savesPerAggregate = 10
+	var (
+		es         eventstore.IEventStore
+		aggregates = []guid.Guid{guid.New(), guid.New()}
+		errs       []error
+	)
+	ensure.That("concurrent saves to different aggregates all succeed with unique positions", func(s *ensure.Scenario) {
+		s.Background("Given an available mongo event store", func() {
+			var err error
+			es, err = NewMongoEventStore(connectionString(t), NewTypeMap().
+				Add(sample_domain.InventoryItemCreated{}).
+				Add(sample_domain.InventoryItemRenamed{}))
+			require.Nil(t, err)
+		})
+
+		s.When("I save to two aggregates at the same time", func() {
+			var (
+				wg sync.WaitGroup
+				mu sync.Mutex
+			)
+			for _, id := range aggregates {
+				wg.Add(1)
+				go func(id guid.Guid) {
+					defer wg.Done()
+					for v := 0; v < savesPerAggregate; v++ {
+						evt := cqrs.NewEvent[sample_domain.InventoryItemRenamed](func(s *sample_domain.InventoryItemRenamed) {
+							s.Id = id
+							s.NewName = "renamed"
+						})
+						err := es.SaveEvents("InventoryItem", id, []cqrs.Event{evt}, v-1)
+						mu.Lock()
+						errs = append(errs, err)
+						mu.Unlock()
+					}
+				}(id)
+			}
+			wg.Wait()
+		})
+
+		s.Then("every save should succeed", func() {
+			require.Len(t, errs, 2*savesPerAggregate)
+			for _, err := range errs {
+				assert.Nil(t, err)
+			}
+		})
+
+		s.And("the events should have unique positions with no gaps", func() {
+			var positions []int64
+			for _, id := range aggregates {
+				events := es.GetEventsForAggregate(id)
+				require.Len(t, events, savesPerAggregate)
+				for _, e := range events {
+					positions = append(positions, cqrs.MetadataOf(e).Position)
+				}
+			}
+			sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+			for i := 1; i < len(positions); i++ {
+				assert.Equal(t, positions[i-1]+1, positions[i])
+			}
+		})
+	}, t)
+}
+
+func TestEnvelopeToEvent(t *testing.T) {
+	var err error
+	ensure.That("an event whose body does not fit its type is not decoded", func(s *ensure.Scenario) {
+		s.When("I decode a body with a field of the wrong type", func() {
+			_, err = envelopeToEvent(reflect.TypeOf(InventoryItemRenamed{}), &dbEvent{
+				Type: "InventoryItemRenamed",
+				Body: `{"NewName":"widget"}`,
+			})
+		})
+
+		s.Then("it should fail", func() {
+			assert.NotNil(t, err)
+		})
+	}, t)
+}
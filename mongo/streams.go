@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	cqrs "github.com/iamkoch/conqueress"
+	"github.com/iamkoch/conqueress/eventstore"
+	"github.com/iamkoch/conqueress/guid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func (m mongoEventStore) ReadAggregateType(ctx context.Context, aggregateType string, after int64, limit int) ([]eventstore.PositionedEvent, error) {
+	return m.readByPosition(ctx, "ReadAggregateType", bson.M{"aggregate_type": aggregateType}, after, limit,
+		eventstore.AggregateTypeKey.String(aggregateType))
+}
+
+func (m mongoEventStore) ReadEventTypes(ctx context.Context, eventTypes []string, after int64, limit int) ([]eventstore.PositionedEvent, error) {
+	return m.readByPosition(ctx, "ReadEventTypes", bson.M{"type": bson.M{"$in": eventTypes}}, after, limit)
+}
+
+func (m mongoEventStore) GetEventsForAggregateFrom(ctx context.Context, aggregateId guid.Guid, fromVersion int) ([]cqrs.Event, error) {
+	return m.readVersions(ctx, "GetEventsForAggregateFrom", aggregateId, bson.M{"$gte": fromVersion})
+}
+
+func (m mongoEventStore) GetEventsForAggregateRange(ctx context.Context, aggregateId guid.Guid, fromVersion, toVersion int) ([]cqrs.Event, error) {
+	return m.readVersions(ctx, "GetEventsForAggregateRange", aggregateId, bson.M{"$gte": fromVersion, "$lte": toVersion})
+}
+
+// readVersions reads the aggregate's events whose version matches versions,
+// in version order.
+func (m mongoEventStore) readVersions(ctx context.Context, operation string, aggregateId guid.Guid, versions bson.M) (events []cqrs.Event, err error) {
+	ctx, span := startSpan(ctx, operation, eventstore.AggregateIdKey.String(aggregateId.String()))
+	defer func() { eventstore.EndSpan(span, err) }()
+	defer eventstore.ObserveTransaction("mongodb", operation, time.Now())
+
+	c, err := m.client.Database("devly").Collection("events").Find(ctx,
+		bson.M{"aggregate_id": aggregateId.String(), "version": versions},
+		options.Find().SetSort(bson.D{{Key: "version", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var results []dbEvent
+	if err = c.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	events = make([]cqrs.Event, 0, len(results))
+	for _, dbe := range results {
+		t, err := m.tm.Get(dbe.Type)
+		if err != nil {
+			return nil, err
+		}
+		evt, err := envelopeToEvent(t, &dbe)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, evt)
+	}
+	return events, nil
+}
+
+// readByPosition reads up to limit events that match filter and come after
+// the given position, lowest first.
+func (m mongoEventStore) readByPosition(ctx context.Context, operation string, filter bson.M, after int64, limit int, attrs ...attribute.KeyValue) (events []eventstore.PositionedEvent, err error) {
+	ctx, span := startSpan(ctx, operation, attrs...)
+	defer func() { eventstore.EndSpan(span, err) }()
+	defer eventstore.ObserveTransaction("mongodb", operation, time.Now())
+
+	filter["position"] = bson.M{"$gt": after}
+	c, err := m.client.Database("devly").Collection("events").Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "position", Value: 1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+
+	var results []dbEvent
+	if err = c.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	events = make([]eventstore.PositionedEvent, 0, len(results))
+	for _, dbe := range results {
+		t, err := m.tm.Get(dbe.Type)
+		if err != nil {
+			return nil, err
+		}
+		evt, err := envelopeToEvent(t, &dbe)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, eventstore.PositionedEvent{Position: dbe.Position, Event: evt})
+	}
+	return events, nil
+}
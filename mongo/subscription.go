@@ -0,0 +1,65 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/iamkoch/conqueress/eventstore"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ReadAll reads events in order of the global position SaveEvents assigns
+// them. Events saved before positions were assigned have none, and are not
+// read.
+func (m mongoEventStore) ReadAll(ctx context.Context, after int64, limit int) ([]eventstore.PositionedEvent, error) {
+	return m.readByPosition(ctx, "ReadAll", bson.M{}, after, limit)
+}
+
+type dbCheckpoint struct {
+	Name     string `bson:"_id"`
+	Position int64  `bson:"position"`
+}
+
+type mongoCheckpointStore struct {
+	client *mongo.Client
+}
+
+// NewMongoCheckpointStore returns an eventstore.CheckpointStore that keeps
+// subscription checkpoints in the checkpoints collection.
+func NewMongoCheckpointStore(cs ConnectionString) (eventstore.CheckpointStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(string(cs)))
+	if err != nil {
+		return nil, err
+	}
+	return &mongoCheckpointStore{client}, nil
+}
+
+func (s *mongoCheckpointStore) collection() *mongo.Collection {
+	return s.client.Database("devly").Collection("checkpoints")
+}
+
+func (s *mongoCheckpointStore) Load(ctx context.Context, name string) (int64, error) {
+	var dbc dbCheckpoint
+	err := s.collection().FindOne(ctx, bson.M{"_id": name}).Decode(&dbc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return dbc.Position, nil
+}
+
+func (s *mongoCheckpointStore) Save(ctx context.Context, name string, position int64) error {
+	_, err := s.collection().UpdateOne(ctx,
+		bson.M{"_id": name},
+		bson.M{"$set": bson.M{"position": position}},
+		options.Update().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	cqrs "github.com/iamkoch/conqueress"
+	"github.com/iamkoch/conqueress/eventstore"
+	"github.com/iamkoch/conqueress/guid"
+	"github.com/iamkoch/conqueress/sample_domain"
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAll(t *testing.T) {
+	var (
+		es      eventstore.IEventStore
+		created sample_domain.InventoryItemCreated
+		renamed sample_domain.InventoryItemRenamed
+		events  []eventstore.PositionedEvent
+		err     error
+	)
+	ensure.That("saved events are read in order of their global position", func(s *ensure.Scenario) {
+		s.Background("Given an available mongo event store", func() {
+			es, err = NewMongoEventStore(connectionString(t), NewTypeMap().
+				Add(sample_domain.InventoryItemCreated{}).
+				Add(sample_domain.InventoryItemRenamed{}))
+			require.Nil(t, err)
+		})
+
+		s.When("I save two events together and read from before the first", func() {
+			id := guid.New()
+			created = cqrs.NewEvent[sample_domain.InventoryItemCreated](func(s *sample_domain.InventoryItemCreated) {
+				s.Id = id
+				s.Name = "first"
+			})
+			renamed = cqrs.NewEvent[sample_domain.InventoryItemRenamed](func(s *sample_domain.InventoryItemRenamed) {
+				s.Id = id
+				s.NewName = "second"
+			})
+			require.Nil(t, es.SaveEvents("InventoryItem", id, []cqrs.Event{created, renamed}, -1))
+			after := cqrs.MetadataOf(created).Position - 1
+			events, err = es.(eventstore.IAllEventsReader).ReadAll(context.Background(), after, 2)
+		})
+
+		s.Then("both events should be read with consecutive positions", func() {
+			require.Nil(t, err)
+			require.Len(t, events, 2)
+			assert.Equal(t, created.MsgId(), events[0].Event.MsgId())
+			assert.Equal(t, renamed.MsgId(), events[1].Event.MsgId())
+			assert.Equal(t, events[0].Position+1, events[1].Position)
+		})
+	}, t)
+}
+
+func TestCheckpointStore(t *testing.T) {
+	var (
+		cs       eventstore.CheckpointStore
+		name     = "subscription-" + guid.New().String()
+		position int64
+		err      error
+	)
+	ensure.That("subscription checkpoints are kept by name", func(s *ensure.Scenario) {
+		s.Background("Given an available mongo checkpoint store", func() {
+			cs, err = NewMongoCheckpointStore(connectionString(t))
+			require.Nil(t, err)
+		})
+
+		s.When("I load a checkpoint that has not been saved", func() {
+			position, err = cs.Load(context.Background(), name)
+		})
+
+		s.Then("it should be at the start", func() {
+			require.Nil(t, err)
+			assert.Equal(t, int64(0), position)
+		})
+
+		s.And("it should be at the last position saved once it has been", func() {
+			require.Nil(t, cs.Save(context.Background(), name, 41))
+			require.Nil(t, cs.Save(context.Background(), name, 42))
+			position, err = cs.Load(context.Background(), name)
+			require.Nil(t, err)
+			assert.Equal(t, int64(42), position)
+		})
+	}, t)
+}
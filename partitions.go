@@ -0,0 +1,126 @@
+package conqueress
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"reflect"
+	"time"
+)
+
+const (
+	defaultWorkers    = 1
+	defaultQueueDepth = 1024
+)
+
+// ErrQueueFull is returned by Dispatch and DispatchContext when the command's
+// partition has no room left and none frees up within the enqueue timeout.
+var ErrQueueFull = errors.New("command queue is full")
+
+// AggregateCommand is implemented by commands that act on a single aggregate.
+// The mediator uses AggregateID as the command's partition key, so commands
+// for the same aggregate are handled one at a time in the order they were
+// dispatched, while commands for different aggregates can run in parallel.
+type AggregateCommand interface {
+	AggregateID() string
+}
+
+// PartitionKeyFunc returns the key a command is partitioned by. Commands with
+// equal keys are handled in dispatch order on the same worker.
+type PartitionKeyFunc func(cmd Command) string
+
+// MediatorOption configures a Mediator created by NewMediator.
+type MediatorOption func(*Mediator)
+
+// WithWorkers sets the number of goroutines that handle queued commands. Each
+// worker owns one partition of the queue. The default is a single worker,
+// which handles every command in dispatch order.
+func WithWorkers(n int) MediatorOption {
+	return func(m *Mediator) {
+		if n > 0 {
+			m.workers = n
+		}
+	}
+}
+
+// WithQueueDepth sets how many commands each partition holds before Dispatch
+// starts applying backpressure. The default is 1024.
+func WithQueueDepth(n int) MediatorOption {
+	return func(m *Mediator) {
+		if n >= 0 {
+			m.queueDepth = n
+		}
+	}
+}
+
+// WithEnqueueTimeout sets how long Dispatch waits for room in a full partition
+// before it gives up with ErrQueueFull. The default of zero does not wait at
+// all. DispatchContext also gives up when its context is done, whichever comes
+// first.
+func WithEnqueueTimeout(d time.Duration) MediatorOption {
+	return func(m *Mediator) {
+		m.enqueueTimeout = d
+	}
+}
+
+// WithPartitionKey replaces the default partition key, which is the
+// command's AggregateID when it implements AggregateCommand and the name of
+// its type otherwise.
+func WithPartitionKey(key PartitionKeyFunc) MediatorOption {
+	return func(m *Mediator) {
+		m.partitionKey = key
+	}
+}
+
+func defaultPartitionKey(cmd Command) string {
+	if ac, ok := cmd.(AggregateCommand); ok {
+		return ac.AggregateID()
+	}
+	return reflect.TypeOf(cmd).String()
+}
+
+func (m *Mediator) partitionFor(cmd Command) chan queuedCommand {
+	if len(m.partitions) == 1 {
+		return m.partitions[0]
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(m.partitionKey(cmd)))
+	return m.partitions[h.Sum32()%uint32(len(m.partitions))]
+}
+
+// enqueue puts qc on its partition, waiting for room no longer than the
+// enqueue timeout or the life of ctx.
+func (m *Mediator) enqueue(ctx context.Context, qc queuedCommand) error {
+	partition := m.partitionFor(qc.cmd)
+
+	select {
+	case partition <- qc:
+		return nil
+	default:
+	}
+
+	if m.enqueueTimeout <= 0 {
+		return ErrQueueFull
+	}
+
+	timer := time.NewTimer(m.enqueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case partition <- qc:
+		return nil
+	case <-timer.C:
+		return ErrQueueFull
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// QueueDepth returns the number of commands waiting across all partitions.
+func (m *Mediator) QueueDepth() int {
+	depth := 0
+	for _, p := range m.partitions {
+		depth += len(p)
+	}
+	return depth
+}
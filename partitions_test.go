@@ -0,0 +1,138 @@
+package conqueress
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type partitionedCmd struct {
+	aggregate string
+	seq       int
+}
+
+func (c partitionedCmd) AggregateID() string {
+	return c.aggregate
+}
+
+func TestCommandsForOneAggregateStayInOrder(t *testing.T) {
+	var (
+		mediator *Mediator
+		mu       sync.Mutex
+		seen     []int
+		resp     = make(chan CommandProcessingError, 50)
+	)
+	ensure.That("commands for the same aggregate are handled in dispatch order", func(s *ensure.Scenario) {
+		s.Given("a mediator with several workers", func() {
+			mediator = NewMediator(false, WithWorkers(4))
+			_ = RegisterCommandHandler[partitionedCmd](mediator, func(cmd Command) error {
+				mu.Lock()
+				defer mu.Unlock()
+				seen = append(seen, cmd.(partitionedCmd).seq)
+				return nil
+			})
+		})
+
+		s.When("I dispatch many commands for one aggregate", func() {
+			for i := 0; i < 50; i++ {
+				require.Nil(t, mediator.Dispatch(partitionedCmd{"agg-1", i}, resp))
+			}
+			for i := 0; i < 50; i++ {
+				<-resp
+			}
+		})
+
+		s.Then("they should have been handled in order", func() {
+			mu.Lock()
+			defer mu.Unlock()
+			for i, v := range seen {
+				assert.Equal(t, i, v)
+			}
+			assert.Len(t, seen, 50)
+		})
+	}, t)
+}
+
+func TestCommandsForDifferentAggregatesRunInParallel(t *testing.T) {
+	var (
+		mediator *Mediator
+		started  = make(chan string, 2)
+		release  = make(chan struct{})
+		a, b     partitionedCmd
+	)
+	ensure.That("a slow command does not stall commands on another partition", func(s *ensure.Scenario) {
+		s.Given("a mediator with two workers and a handler that blocks", func() {
+			mediator = NewMediator(false, WithWorkers(2))
+			_ = RegisterCommandHandler[partitionedCmd](mediator, func(cmd Command) error {
+				started <- cmd.(partitionedCmd).aggregate
+				<-release
+				return nil
+			})
+		})
+
+		s.And("two aggregates that land on different partitions", func() {
+			a = partitionedCmd{aggregate: "a"}
+			for i := 0; ; i++ {
+				b = partitionedCmd{aggregate: string(rune('b' + i))}
+				if mediator.partitionFor(a) != mediator.partitionFor(b) {
+					break
+				}
+			}
+		})
+
+		s.When("I dispatch a command for each", func() {
+			_ = mediator.Dispatch(a, nil)
+			_ = mediator.Dispatch(b, nil)
+		})
+
+		s.Then("both handlers should be running at once", func() {
+			for i := 0; i < 2; i++ {
+				select {
+				case <-started:
+				case <-time.After(time.Second):
+					t.Fatal("second command did not start while the first was blocked")
+				}
+			}
+			close(release)
+		})
+	}, t)
+}
+
+func TestDispatchAppliesBackpressure(t *testing.T) {
+	var (
+		mediator *Mediator
+		started  = make(chan struct{}, 1)
+		release  = make(chan struct{})
+		err      error
+	)
+	ensure.That("dispatching to a full partition fails instead of blocking", func(s *ensure.Scenario) {
+		s.Given("a mediator with a queue depth of one and a blocked worker", func() {
+			mediator = NewMediator(false, WithQueueDepth(1), WithEnqueueTimeout(10*time.Millisecond))
+			_ = RegisterCommandHandler[TestCmd](mediator, func(cmd Command) error {
+				started <- struct{}{}
+				<-release
+				return nil
+			})
+			require.Nil(t, mediator.Dispatch(TestCmd{}, nil))
+			<-started
+		})
+
+		s.And("a second command filling the queue", func() {
+			require.Nil(t, mediator.Dispatch(TestCmd{}, nil))
+			assert.Equal(t, 1, mediator.QueueDepth())
+		})
+
+		s.When("I dispatch a third", func() {
+			err = mediator.Dispatch(TestCmd{}, nil)
+		})
+
+		s.Then("it should be refused", func() {
+			assert.ErrorIs(t, err, ErrQueueFull)
+			close(release)
+		})
+	}, t)
+}
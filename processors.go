@@ -0,0 +1,281 @@
+package conqueress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/iamkoch/conqueress/guid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// GiveUpAction says what the mediator does with an event once a processor has
+// failed on it and has no retries left.
+type GiveUpAction int
+
+const (
+	// GiveUpReport returns the failure from PublishSync and hands it to the
+	// failure observer. This is the default.
+	GiveUpReport GiveUpAction = iota
+	// GiveUpDeadLetter puts the failure in the mediator's dead-letter sink
+	// and hands it to the failure observer. PublishSync does not return it,
+	// because the event has been set aside rather than lost.
+	GiveUpDeadLetter
+	// GiveUpIgnore logs the failure and drops it.
+	GiveUpIgnore
+)
+
+// Backoff returns how long to wait before the given retry, counting from 1.
+type Backoff func(retry int) time.Duration
+
+// ConstantBackoff waits d before every retry.
+func ConstantBackoff(d time.Duration) Backoff {
+	return func(int) time.Duration {
+		return d
+	}
+}
+
+// ExponentialBackoff waits base before the first retry and doubles the wait
+// for each one after, up to max.
+func ExponentialBackoff(base, max time.Duration) Backoff {
+	return func(retry int) time.Duration {
+		d := base
+		for i := 1; i < retry && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			return max
+		}
+		return d
+	}
+}
+
+// RetryPolicy controls what happens when a processor returns an error. The
+// zero value tries once and reports the failure.
+type RetryPolicy struct {
+	// MaxRetries is the number of attempts made after the first one fails.
+	MaxRetries int
+	// Backoff is the wait before each retry. Nil retries at once.
+	Backoff Backoff
+	// GiveUp is what happens once the retries are used up.
+	GiveUp GiveUpAction
+}
+
+// ProcessorFailure records a processor that failed on an event and ran out of
+// retries.
+type ProcessorFailure struct {
+	Id        guid.Guid
+	Event     Event
+	Processor string
+	Err       error
+	Attempts  int
+	FailedAt  time.Time
+}
+
+// FailureObserver is told about every processor failure once its retries are
+// used up, whichever publish method delivered the event.
+type FailureObserver func(ctx context.Context, failure ProcessorFailure)
+
+// EventProcessingError is returned by PublishSync when one or more processors
+// failed on the event and their policy is to report it.
+type EventProcessingError struct {
+	Event    Event
+	Failures []ProcessorFailure
+}
+
+func (e *EventProcessingError) Error() string {
+	names := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		names = append(names, fmt.Sprintf("%s: %v", f.Processor, f.Err))
+	}
+	return fmt.Sprintf("%d processor(s) failed on %v: %s", len(e.Failures), reflect.TypeOf(e.Event), strings.Join(names, "; "))
+}
+
+func (e *EventProcessingError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		errs = append(errs, f.Err)
+	}
+	return errs
+}
+
+// ProcessorOption configures a single event processor registration.
+type ProcessorOption func(*processorRegistration)
+
+// WithProcessorName names the processor. The name identifies it in failures
+// and dead letters, and is how Replay finds it again, so it must be unique
+// among the processors for the event type, or among the wildcard
+// subscriptions, and registering a second processor with the same name fails
+// with ErrDuplicateRegistration. It defaults to the name of the processor's
+// function, which method values of the same method, and closures made by the
+// same function, share, so processors like those need a name given here.
+func WithProcessorName(name string) ProcessorOption {
+	return func(r *processorRegistration) {
+		r.name = name
+	}
+}
+
+// WithRetry sets the processor's retry policy, replacing the mediator's
+// default.
+func WithRetry(policy RetryPolicy) ProcessorOption {
+	return func(r *processorRegistration) {
+		r.policy = &policy
+	}
+}
+
+// WithDefaultRetryPolicy sets the retry policy for processors registered
+// without WithRetry.
+func WithDefaultRetryPolicy(policy RetryPolicy) MediatorOption {
+	return func(m *Mediator) {
+		m.defaultRetryPolicy = policy
+	}
+}
+
+// WithFailureObserver sets the function told about processor failures. The
+// default logs them.
+func WithFailureObserver(observer FailureObserver) MediatorOption {
+	return func(m *Mediator) {
+		m.failureObserver = observer
+	}
+}
+
+// WithDeadLetterSink sets where failures go when a processor's policy is
+// GiveUpDeadLetter.
+func WithDeadLetterSink(sink DeadLetterSink) MediatorOption {
+	return func(m *Mediator) {
+		m.deadLetters = sink
+	}
+}
+
+type processorRegistration struct {
+	name      string
+	processor ContextEventProcessor
+	policy    *RetryPolicy
+	removed   atomic.Bool
+}
+
+func newProcessorRegistration(processor ContextEventProcessor, defaultName string, opts []ProcessorOption) *processorRegistration {
+	r := &processorRegistration{name: defaultName, processor: processor}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// funcName returns the name of the function f, which identifies a processor
+// when it is not given one.
+func funcName(f any) string {
+	return runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+}
+
+func logFailure(_ context.Context, f ProcessorFailure) {
+	slog.With(
+		"event", f.Event,
+		"type", reflect.TypeOf(f.Event),
+		"processor", f.Processor,
+		"attempts", f.Attempts,
+		"error", f.Err,
+	).Error("Event processor failed")
+}
+
+// deliver runs one processor on evt, retrying according to its policy, after
+// applying what chaos mode planned for the delivery. It returns the failure
+// when the policy is to report it, and nil otherwise.
+func (m *Mediator) deliver(ctx context.Context, evt Event, r *processorRegistration, plan eventChaos) *ProcessorFailure {
+	pause(ctx, plan.delay)
+
+	started := time.Now()
+	ctx = eventContext(ctx, evt)
+	ctx, span := m.startEventSpan(ctx, "process", evt,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(ProcessorKey.String(r.name)))
+	failure := m.attempt(ctx, evt, r, plan.failures)
+	if plan.duplicate && failure == nil {
+		failure = m.attempt(ctx, evt, r, 0)
+	}
+	if failure != nil {
+		span.SetStatus(codes.Error, failure.Err.Error())
+	}
+	span.End()
+	m.observeDelivery(evt, r, started)
+	return failure
+}
+
+// attempt delivers evt to r, retrying according to r's policy, with the
+// first injectFailures attempts failing without running the processor.
+func (m *Mediator) attempt(ctx context.Context, evt Event, r *processorRegistration, injectFailures int) *ProcessorFailure {
+	policy := m.defaultRetryPolicy
+	if r.policy != nil {
+		policy = *r.policy
+	}
+
+	processor := m.snapshot().wrapEventProcessor(r.processor)
+
+	var err error
+	attempts := 0
+	for {
+		if r.removed.Load() {
+			return nil
+		}
+		attempts++
+		if attempts <= injectFailures {
+			err = ErrInjectedFailure
+		} else if err = processor(ctx, evt); err == nil {
+			return nil
+		}
+		trace.SpanFromContext(ctx).RecordError(err, trace.WithAttributes(attribute.Int("attempt", attempts)))
+		if attempts > policy.MaxRetries {
+			break
+		}
+		if policy.Backoff != nil {
+			timer := time.NewTimer(policy.Backoff(attempts))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				err = errors.Join(err, ctx.Err())
+				return m.giveUp(ctx, policy, r, evt, err, attempts)
+			}
+		}
+	}
+
+	return m.giveUp(ctx, policy, r, evt, err, attempts)
+}
+
+func (m *Mediator) giveUp(ctx context.Context, policy RetryPolicy, r *processorRegistration, evt Event, err error, attempts int) *ProcessorFailure {
+	failure := ProcessorFailure{
+		Id:        guid.New(),
+		Event:     evt,
+		Processor: r.name,
+		Err:       err,
+		Attempts:  attempts,
+		FailedAt:  time.Now().UTC(),
+	}
+	m.countProcessorFailure(evt, r)
+
+	switch policy.GiveUp {
+	case GiveUpIgnore:
+		logFailure(ctx, failure)
+		return nil
+	case GiveUpDeadLetter:
+		if m.deadLetters != nil {
+			if e := m.deadLetters.Put(ctx, failure); e == nil {
+				m.failureObserver(ctx, failure)
+				return nil
+			} else {
+				failure.Err = errors.Join(failure.Err, fmt.Errorf("dead-lettering failed: %w", e))
+			}
+		}
+	}
+
+	m.failureObserver(ctx, failure)
+	return &failure
+}
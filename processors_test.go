@@ -0,0 +1,148 @@
+package conqueress
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessorRetries(t *testing.T) {
+	var (
+		mediator *Mediator
+		attempts atomic.Int32
+		err      error
+	)
+	ensure.That("a failing processor is retried according to its policy", func(s *ensure.Scenario) {
+		s.Given("a processor that fails twice before succeeding", func() {
+			mediator = NewMediator(false)
+			_ = RegisterEventProcessor[TestEvent](mediator, func(ctx context.Context, evt Event) error {
+				if attempts.Add(1) < 3 {
+					return errors.New("transient")
+				}
+				return nil
+			}, WithRetry(RetryPolicy{MaxRetries: 2, Backoff: ConstantBackoff(time.Millisecond)}))
+		})
+
+		s.When("I publish an event synchronously", func() {
+			err = mediator.PublishSync(TestEvent{})
+		})
+
+		s.Then("it should succeed on the third attempt", func() {
+			assert.Nil(t, err)
+			assert.Equal(t, int32(3), attempts.Load())
+		})
+	}, t)
+}
+
+func TestPublishSyncAggregatesFailures(t *testing.T) {
+	var (
+		mediator *Mediator
+		first    = errors.New("first")
+		second   = errors.New("second")
+		ran      atomic.Int32
+		err      error
+	)
+	ensure.That("PublishSync runs every processor and returns all their failures", func(s *ensure.Scenario) {
+		s.Given("three processors, two of which fail", func() {
+			mediator = NewMediator(false)
+			_ = RegisterEventProcessor[TestEvent](mediator, func(ctx context.Context, evt Event) error {
+				ran.Add(1)
+				return first
+			}, WithProcessorName("first"))
+			_ = RegisterEventProcessor[TestEvent](mediator, func(ctx context.Context, evt Event) error {
+				ran.Add(1)
+				return nil
+			}, WithProcessorName("ok"))
+			_ = RegisterEventProcessor[TestEvent](mediator, func(ctx context.Context, evt Event) error {
+				ran.Add(1)
+				return second
+			}, WithProcessorName("second"))
+		})
+
+		s.When("I publish an event synchronously", func() {
+			err = mediator.PublishSync(TestEvent{})
+		})
+
+		s.Then("every processor should have run", func() {
+			assert.Equal(t, int32(3), ran.Load())
+		})
+
+		s.And("both failures should be reported", func() {
+			var processingErr *EventProcessingError
+			require.ErrorAs(t, err, &processingErr)
+			assert.Len(t, processingErr.Failures, 2)
+			assert.Equal(t, "first", processingErr.Failures[0].Processor)
+			assert.Equal(t, "second", processingErr.Failures[1].Processor)
+			assert.ErrorIs(t, err, first)
+			assert.ErrorIs(t, err, second)
+		})
+	}, t)
+}
+
+func TestDeadLettering(t *testing.T) {
+	var (
+		mediator *Mediator
+		sink     = NewInMemoryDeadLetterSink()
+		observed = make(chan ProcessorFailure, 1)
+		broken   atomic.Bool
+	)
+	ensure.That("failures from asynchronous processors are observed, dead-lettered and replayable", func(s *ensure.Scenario) {
+		s.Given("a mediator with a dead-letter sink and an observer", func() {
+			mediator = NewMediator(false,
+				WithDeadLetterSink(sink),
+				WithFailureObserver(func(ctx context.Context, f ProcessorFailure) {
+					observed <- f
+				}))
+		})
+
+		s.And("a processor that fails while broken", func() {
+			broken.Store(true)
+			_ = RegisterEventProcessor[TestEvent](mediator, func(ctx context.Context, evt Event) error {
+				if broken.Load() {
+					return errors.New("read model unavailable")
+				}
+				return nil
+			}, WithProcessorName("read-model"), WithRetry(RetryPolicy{MaxRetries: 1, GiveUp: GiveUpDeadLetter}))
+		})
+
+		s.When("I publish an event", func() {
+			require.Nil(t, mediator.Publish(TestEvent{}))
+		})
+
+		s.Then("the observer should be told", func() {
+			select {
+			case f := <-observed:
+				assert.Equal(t, "read-model", f.Processor)
+				assert.Equal(t, 2, f.Attempts)
+			case <-time.After(time.Second):
+				t.Fatal("observer was not called")
+			}
+		})
+
+		s.And("the failure should be in the sink", func() {
+			assert.Len(t, sink.Failures(), 1)
+		})
+
+		s.And("it should replay once the processor is fixed", func() {
+			broken.Store(false)
+			f := sink.Failures()[0]
+			assert.Nil(t, mediator.Replay(context.Background(), f))
+			sink.Remove(f.Id)
+			assert.Empty(t, sink.Failures())
+		})
+	}, t)
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(10*time.Millisecond, 50*time.Millisecond)
+	assert.Equal(t, 10*time.Millisecond, backoff(1))
+	assert.Equal(t, 20*time.Millisecond, backoff(2))
+	assert.Equal(t, 40*time.Millisecond, backoff(3))
+	assert.Equal(t, 50*time.Millisecond, backoff(4))
+}
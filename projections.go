@@ -1,6 +1,10 @@
 package conqueress
 
-import "github.com/iamkoch/conqueress/guid"
+import (
+	"context"
+
+	"github.com/iamkoch/conqueress/guid"
+)
 
 type Projection interface {
 	Id() guid.Guid
@@ -49,6 +53,11 @@ func NewBaseProjectionHandler[TProjection Projection](
 	return &BaseProjectionHandler[TProjection]{load, save, factory}
 }
 
+// Load returns the projection with the given ID.
+func (bh BaseProjectionHandler[TProjection]) Load(id guid.Guid) (TProjection, error) {
+	return bh.load(id)
+}
+
 func (bh BaseProjectionHandler[TProjection]) UpdateProjection(
 	id guid.Guid,
 	evt Event,
@@ -70,3 +79,18 @@ func (bh BaseProjectionHandler[TProjection]) UpdateProjection(
 
 	return nil
 }
+
+// ProjectionQuery asks for the projection of type TProjection with the given
+// ID.
+type ProjectionQuery[TProjection Projection] struct {
+	Id guid.Guid
+}
+
+// RegisterProjectionQuery answers ProjectionQuery[TProjection] by loading the
+// projection through the handler, so every projection built on
+// BaseProjectionHandler can be read with Ask in the same way.
+func RegisterProjectionQuery[TProjection Projection](m *Mediator, handler *BaseProjectionHandler[TProjection]) error {
+	return RegisterQueryHandler[ProjectionQuery[TProjection]](m, func(_ context.Context, q ProjectionQuery[TProjection]) (TProjection, error) {
+		return handler.Load(q.Id)
+	})
+}
@@ -0,0 +1,105 @@
+package conqueress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+)
+
+// Query asks the read side a question. Unlike a Command it does not change
+// state, and unlike an Event it has exactly one handler, which returns an
+// answer.
+type Query interface {
+}
+
+// QueryHandler answers a query. RegisterQueryHandler adapts a typed handler
+// to this form.
+type QueryHandler func(ctx context.Context, q Query) (any, error)
+
+// RegisterQueryHandler registers the handler that answers queries of type Q
+// with an R.
+func RegisterQueryHandler[Q Query, R any](m *Mediator, handler func(ctx context.Context, q Q) (R, error)) error {
+	var q Q
+	return m.RegisterQueryHandler(reflect.TypeOf(q), func(ctx context.Context, query Query) (any, error) {
+		typed, err := as[Q](query)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, typed)
+	})
+}
+
+func (m *Mediator) RegisterQueryHandler(queryType reflect.Type, handler QueryHandler) error {
+	err := m.updateRegistry(func(r *registry) error {
+		if r.sealed {
+			return ErrRegistrySealed
+		}
+		if _, exists := r.queryHandlers[queryType]; exists {
+			return errors.New("query handler already registered")
+		}
+		r.queryHandlers[queryType] = handler
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.With(
+		"query", queryType,
+	).Info("Registering query handler")
+	return nil
+}
+
+// Ask answers q on the calling goroutine.
+func Ask[Q Query, R any](m *Mediator, q Q) (R, error) {
+	return AskContext[Q, R](context.Background(), m, q)
+}
+
+// AskContext answers q on the calling goroutine. The query passes through the
+// command middleware added with Use, in the place of a command, so
+// cross-cutting concerns such as authorization and logging apply to queries
+// too.
+func AskContext[Q Query, R any](ctx context.Context, m *Mediator, q Q) (R, error) {
+	var zero R
+
+	answer, err := m.AskContext(ctx, q)
+	if err != nil {
+		return zero, err
+	}
+
+	if answer == nil {
+		return zero, nil
+	}
+
+	r, ok := answer.(R)
+	if !ok {
+		return zero, fmt.Errorf("query %v was answered with %T, not %v", reflect.TypeOf(q), answer, reflect.TypeOf((*R)(nil)).Elem())
+	}
+	return r, nil
+}
+
+// AskContext answers q with whatever its handler returns. Prefer the generic
+// AskContext function, which checks the answer's type.
+func (m *Mediator) AskContext(ctx context.Context, q Query) (any, error) {
+	of := reflect.TypeOf(q)
+	reg := m.snapshot()
+	handler, ok := reg.queryHandlers[of]
+	if !ok {
+		return nil, errors.New("no query handler registered")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	slog.With(
+		"type", of,
+		"query", q,
+	).Debug("Answering query")
+
+	return reg.invoke(ctx, q, func(ctx context.Context, cmd Command) (any, error) {
+		return handler(ctx, cmd)
+	})
+}
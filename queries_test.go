@@ -0,0 +1,97 @@
+package conqueress
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iamkoch/conqueress/guid"
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+)
+
+type stockLevelQuery struct {
+	sku string
+}
+
+type testProjection struct {
+	BaseProjection
+	name string
+}
+
+func TestAsk(t *testing.T) {
+	var (
+		mediator *Mediator
+		seen     []Command
+		answer   int
+		err      error
+	)
+	ensure.That("queries are answered by their handler through the middleware", func(s *ensure.Scenario) {
+		s.Given("a mediator with a query handler and a middleware", func() {
+			mediator = NewMediator(false)
+			_ = RegisterQueryHandler[stockLevelQuery](mediator, func(ctx context.Context, q stockLevelQuery) (int, error) {
+				return len(q.sku), nil
+			})
+			mediator.Use(func(next ContextCommandHandler) ContextCommandHandler {
+				return func(ctx context.Context, cmd Command) error {
+					seen = append(seen, cmd)
+					return next(ctx, cmd)
+				}
+			})
+		})
+
+		s.When("I ask a question", func() {
+			answer, err = Ask[stockLevelQuery, int](mediator, stockLevelQuery{"widget"})
+		})
+
+		s.Then("it should be answered", func() {
+			assert.Nil(t, err)
+			assert.Equal(t, 6, answer)
+		})
+
+		s.And("the middleware should have seen the query", func() {
+			assert.Equal(t, []Command{stockLevelQuery{"widget"}}, seen)
+		})
+
+		s.And("asking for the wrong answer type should fail", func() {
+			_, err := Ask[stockLevelQuery, string](mediator, stockLevelQuery{"widget"})
+			assert.NotNil(t, err)
+		})
+
+		s.And("asking an unregistered question should fail", func() {
+			_, err := Ask[TestCmd, int](mediator, TestCmd{})
+			assert.NotNil(t, err)
+		})
+	}, t)
+}
+
+func TestProjectionQuery(t *testing.T) {
+	var (
+		mediator *Mediator
+		id       = guid.New()
+		loaded   *testProjection
+		err      error
+	)
+	ensure.That("projections can be read through the query bus", func(s *ensure.Scenario) {
+		s.Given("a mediator with a projection handler registered for queries", func() {
+			mediator = NewMediator(false)
+			handler := NewBaseProjectionHandler[*testProjection](
+				func(id guid.Guid) (*testProjection, error) {
+					return &testProjection{NewBaseProjection(id, 3), "widget"}, nil
+				},
+				func(p *testProjection) error { return nil },
+				func(id guid.Guid) *testProjection { return &testProjection{} },
+			)
+			_ = RegisterProjectionQuery[*testProjection](mediator, handler)
+		})
+
+		s.When("I ask for the projection", func() {
+			loaded, err = Ask[ProjectionQuery[*testProjection], *testProjection](mediator, ProjectionQuery[*testProjection]{Id: id})
+		})
+
+		s.Then("it should be loaded", func() {
+			assert.Nil(t, err)
+			assert.Equal(t, id, loaded.Id())
+			assert.Equal(t, "widget", loaded.name)
+		})
+	}, t)
+}
@@ -0,0 +1,222 @@
+package conqueress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+)
+
+// ErrDuplicateRegistration is returned when a processor is registered under a
+// name that another processor for the same event type, or another wildcard
+// subscription, already has.
+var ErrDuplicateRegistration = errors.New("a processor with that name is already registered")
+
+// Registration is a handle on a command handler or event processor, returned
+// by Handle and the Subscribe family. Unregister removes it.
+type Registration struct {
+	name    string
+	mu      sync.Mutex
+	removed bool
+	remove  func() error
+}
+
+// Name returns the name the handler or processor was registered under. A
+// command handler's name is the name of its command type.
+func (r *Registration) Name() string {
+	return r.name
+}
+
+// Unregister removes the handler or processor. Commands already queued for a
+// removed handler fail with an error when they reach the front of the queue,
+// and a removed processor is skipped by deliveries that have not yet started
+// it, including retries. Calling Unregister again does nothing. It fails with
+// ErrRegistrySealed once the mediator is sealed.
+func (r *Registration) Unregister() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.removed {
+		return nil
+	}
+	if err := r.remove(); err != nil {
+		return err
+	}
+	r.removed = true
+	return nil
+}
+
+type commandRegistration struct {
+	handler ResultCommandHandler
+	// resultType is the type of the handler's result, when it is known, so
+	// results recorded for deduplication can be decoded into it again.
+	resultType reflect.Type
+}
+
+// Handle registers the handler for commands of type T, which receives the
+// command as a T, and returns a handle that can remove it again.
+func Handle[T Command](m *Mediator, handler func(ctx context.Context, cmd T) error) (*Registration, error) {
+	var t T
+	return m.Handle(reflect.TypeOf(t), func(ctx context.Context, cmd Command) error {
+		typed, err := as[T](cmd)
+		if err != nil {
+			return err
+		}
+		return handler(ctx, typed)
+	})
+}
+
+// Handle registers the handler for commands of type cmdType and returns a
+// handle that can remove it again.
+func (m *Mediator) Handle(cmdType reflect.Type, handler ContextCommandHandler) (*Registration, error) {
+	return m.HandleWithResult(cmdType, handler.withResult())
+}
+
+// HandleWithResult registers a handler that returns a result for commands of
+// type cmdType, and returns a handle that can remove it again.
+func (m *Mediator) HandleWithResult(cmdType reflect.Type, handler ResultCommandHandler) (*Registration, error) {
+	return m.handle(cmdType, &commandRegistration{handler: handler})
+}
+
+func (m *Mediator) handle(cmdType reflect.Type, registration *commandRegistration) (*Registration, error) {
+	err := m.updateRegistry(func(r *registry) error {
+		if r.sealed {
+			return ErrRegistrySealed
+		}
+		if _, exists := r.commandHandlers[cmdType]; exists {
+			return errors.New("command handler already registered")
+		}
+		r.commandHandlers[cmdType] = registration
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.With(
+		"command", cmdType,
+	).Info("Registering command handler")
+
+	return &Registration{
+		name: cmdType.String(),
+		remove: func() error {
+			return m.updateRegistry(func(r *registry) error {
+				if r.sealed {
+					return ErrRegistrySealed
+				}
+				if r.commandHandlers[cmdType] == registration {
+					delete(r.commandHandlers, cmdType)
+				}
+				return nil
+			})
+		},
+	}, nil
+}
+
+// Subscribe registers a processor for events of type T, which receives the
+// event as a T, and returns a handle that can remove it again.
+func Subscribe[T Event](m *Mediator, processor func(ctx context.Context, evt T) error, opts ...ProcessorOption) (*Registration, error) {
+	var t T
+	return m.subscribe(reflect.TypeOf(t), newProcessorRegistration(typedProcessor(processor), funcName(processor), opts))
+}
+
+// Subscribe registers a processor for events of type evtType and returns a
+// handle that can remove it again.
+func (m *Mediator) Subscribe(evtType reflect.Type, processor ContextEventProcessor, opts ...ProcessorOption) (*Registration, error) {
+	return m.subscribe(evtType, newProcessorRegistration(processor, funcName(processor), opts))
+}
+
+func (m *Mediator) subscribe(evtType reflect.Type, registration *processorRegistration) (*Registration, error) {
+	err := m.updateRegistry(func(r *registry) error {
+		if r.sealed {
+			return ErrRegistrySealed
+		}
+		handlers := r.eventProcessors[evtType]
+		for _, p := range handlers {
+			if p.name == registration.name {
+				return fmt.Errorf("%w: %s", ErrDuplicateRegistration, registration.name)
+			}
+		}
+		r.eventProcessors[evtType] = append(handlers[:len(handlers):len(handlers)], registration)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Registration{
+		name: registration.name,
+		remove: func() error {
+			err := m.updateRegistry(func(r *registry) error {
+				if r.sealed {
+					return ErrRegistrySealed
+				}
+				remaining := without(r.eventProcessors[evtType], registration)
+				if len(remaining) == 0 {
+					delete(r.eventProcessors, evtType)
+				} else {
+					r.eventProcessors[evtType] = remaining
+				}
+				return nil
+			})
+			if err == nil {
+				registration.removed.Store(true)
+			}
+			return err
+		},
+	}, nil
+}
+
+func (m *Mediator) subscribeWildcard(subscription *wildcardSubscription) (*Registration, error) {
+	registration := subscription.registration
+
+	err := m.updateRegistry(func(r *registry) error {
+		if r.sealed {
+			return ErrRegistrySealed
+		}
+		for _, w := range r.wildcards {
+			if w.registration.name == registration.name {
+				return fmt.Errorf("%w: %s", ErrDuplicateRegistration, registration.name)
+			}
+		}
+		r.wildcards = append(r.wildcards[:len(r.wildcards):len(r.wildcards)], subscription)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Registration{
+		name: registration.name,
+		remove: func() error {
+			err := m.updateRegistry(func(r *registry) error {
+				if r.sealed {
+					return ErrRegistrySealed
+				}
+				remaining := make([]*wildcardSubscription, 0, len(r.wildcards))
+				for _, w := range r.wildcards {
+					if w != subscription {
+						remaining = append(remaining, w)
+					}
+				}
+				r.wildcards = remaining
+				return nil
+			})
+			if err == nil {
+				registration.removed.Store(true)
+			}
+			return err
+		},
+	}, nil
+}
+
+func without(registrations []*processorRegistration, r *processorRegistration) []*processorRegistration {
+	remaining := make([]*processorRegistration, 0, len(registrations))
+	for _, p := range registrations {
+		if p != r {
+			remaining = append(remaining, p)
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,140 @@
+package conqueress
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnregister(t *testing.T) {
+	var (
+		mediator  *Mediator
+		processor *Registration
+		handler   *Registration
+		events    = &TestEvtHandler{}
+		commands  = &TestCmdHandler{}
+	)
+	ensure.That("registrations can be removed through their handles", func(s *ensure.Scenario) {
+		s.Given("a mediator with a command handler and an event processor", func() {
+			var err error
+			mediator = NewMediator(false)
+			handler, err = Handle(mediator, func(ctx context.Context, cmd TestCmd) error {
+				return commands.Handle(cmd)
+			})
+			require.Nil(t, err)
+			processor, err = mediator.Subscribe(reflectTypeOf[TestEvent](), func(ctx context.Context, evt Event) error {
+				return events.Handle(evt)
+			})
+			require.Nil(t, err)
+		})
+
+		s.When("I unregister both", func() {
+			assert.Nil(t, handler.Unregister())
+			assert.Nil(t, processor.Unregister())
+			assert.Nil(t, processor.Unregister())
+		})
+
+		s.Then("commands for the type should be refused", func() {
+			assert.NotNil(t, mediator.DispatchSync(TestCmd{}, nil))
+			assert.Empty(t, commands.Received())
+		})
+
+		s.And("events for the type should have nowhere to go", func() {
+			assert.NotNil(t, mediator.PublishSync(TestEvent{}))
+			assert.Empty(t, events.Received())
+		})
+
+		s.And("the command type should be free to register again", func() {
+			_, err := Handle(mediator, func(ctx context.Context, cmd TestCmd) error { return nil })
+			assert.Nil(t, err)
+		})
+	}, t)
+}
+
+func TestNamedRegistrations(t *testing.T) {
+	var (
+		mediator *Mediator
+		handler1 = &TestEvtHandler{}
+		handler2 = &TestEvtHandler{}
+	)
+	ensure.That("processors are unique by name, whether given or by default", func(s *ensure.Scenario) {
+		s.Given("a mediator", func() {
+			mediator = NewMediator(false)
+		})
+
+		s.Then("a second unnamed method value of the same method should be refused", func() {
+			require.Nil(t, mediator.RegisterEventHandler(reflectTypeOf[TestEvent](), handler1.Handle))
+			assert.ErrorIs(t, mediator.RegisterEventHandler(reflectTypeOf[TestEvent](), handler2.Handle), ErrDuplicateRegistration)
+		})
+
+		s.And("it should register once it is given a name of its own", func() {
+			assert.Nil(t, mediator.RegisterEventHandler(reflectTypeOf[TestEvent](), handler2.Handle, WithProcessorName("handler2")))
+		})
+
+		s.And("the same unnamed processor should not register twice", func() {
+			project := func(ctx context.Context, evt Event) error { return nil }
+			_, err := mediator.Subscribe(reflectTypeOf[TestEvent](), project)
+			require.Nil(t, err)
+			_, err = mediator.Subscribe(reflectTypeOf[TestEvent](), project)
+			assert.ErrorIs(t, err, ErrDuplicateRegistration)
+		})
+
+		s.And("a second processor with the same name should be refused", func() {
+			_, err := mediator.Subscribe(reflectTypeOf[TestEvent](), func(ctx context.Context, evt Event) error {
+				return nil
+			}, WithProcessorName("projection"))
+			require.Nil(t, err)
+
+			_, err = mediator.Subscribe(reflectTypeOf[TestEvent](), func(ctx context.Context, evt Event) error {
+				return nil
+			}, WithProcessorName("projection"))
+			assert.ErrorIs(t, err, ErrDuplicateRegistration)
+		})
+
+		s.And("wildcard subscriptions should be unique by name too", func() {
+			_, err := mediator.SubscribeAll(func(ctx context.Context, evt Event) error { return nil }, WithProcessorName("audit"))
+			require.Nil(t, err)
+			_, err = mediator.SubscribeAll(func(ctx context.Context, evt Event) error { return nil }, WithProcessorName("audit"))
+			assert.ErrorIs(t, err, ErrDuplicateRegistration)
+		})
+	}, t)
+}
+
+func TestUnregisterWhileRetrying(t *testing.T) {
+	var (
+		mediator     *Mediator
+		registration *Registration
+		attempts     atomic.Int32
+		failed       = make(chan struct{}, 1)
+		err          error
+	)
+	ensure.That("a processor removed while an event is in flight is not retried", func(s *ensure.Scenario) {
+		s.Given("a failing processor with a slow retry", func() {
+			mediator = NewMediator(false)
+			registration, _ = mediator.Subscribe(reflectTypeOf[TestEvent](), func(ctx context.Context, evt Event) error {
+				attempts.Add(1)
+				failed <- struct{}{}
+				return errors.New("failed")
+			}, WithRetry(RetryPolicy{MaxRetries: 3, Backoff: ConstantBackoff(50 * time.Millisecond)}))
+		})
+
+		s.When("I unregister it after its first attempt", func() {
+			done := make(chan error)
+			go func() { done <- mediator.PublishSync(TestEvent{}) }()
+			<-failed
+			_ = registration.Unregister()
+			err = <-done
+		})
+
+		s.Then("it should not run again", func() {
+			assert.Nil(t, err)
+			assert.Equal(t, int32(1), attempts.Load())
+		})
+	}, t)
+}
@@ -0,0 +1,139 @@
+package conqueress
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"reflect"
+)
+
+// ErrRegistrySealed is returned by registrations, and by Unregister, once the
+// mediator has been sealed.
+var ErrRegistrySealed = errors.New("mediator registry is sealed")
+
+// registry holds everything registered with a mediator. A registry is never
+// modified once the mediator has published it: a change copies it, applies
+// the change to the copy, and swaps the copy in. Readers load the current
+// registry without taking a lock and keep using the one they loaded, so a
+// publish or dispatch sees a consistent set of handlers however registration
+// changes around it.
+type registry struct {
+	commandHandlers   map[reflect.Type]*commandRegistration
+	queryHandlers     map[reflect.Type]QueryHandler
+	validators        map[reflect.Type][]CommandValidator
+	eventProcessors   map[reflect.Type][]*processorRegistration
+	wildcards         []*wildcardSubscription
+	commandMiddleware []CommandMiddleware
+	eventMiddleware   []EventMiddleware
+	sealed            bool
+}
+
+func newRegistry() *registry {
+	return &registry{
+		commandHandlers: make(map[reflect.Type]*commandRegistration),
+		queryHandlers:   make(map[reflect.Type]QueryHandler),
+		validators:      make(map[reflect.Type][]CommandValidator),
+		eventProcessors: make(map[reflect.Type][]*processorRegistration),
+	}
+}
+
+// clone copies r deeply enough that changing the copy's maps cannot affect
+// r. The slices are shared, so changes must replace them rather than write
+// into them.
+func (r *registry) clone() *registry {
+	return &registry{
+		commandHandlers:   maps.Clone(r.commandHandlers),
+		queryHandlers:     maps.Clone(r.queryHandlers),
+		validators:        maps.Clone(r.validators),
+		eventProcessors:   maps.Clone(r.eventProcessors),
+		wildcards:         r.wildcards,
+		commandMiddleware: r.commandMiddleware,
+		eventMiddleware:   r.eventMiddleware,
+		sealed:            r.sealed,
+	}
+}
+
+// snapshot returns the current registry. It never blocks.
+func (m *Mediator) snapshot() *registry {
+	return m.registry.Load()
+}
+
+// updateRegistry applies change to a copy of the current registry and
+// publishes the copy, unless change returns an error. Changes are
+// serialised, so none is lost to a concurrent one.
+func (m *Mediator) updateRegistry(change func(r *registry) error) error {
+	m.registryWrite.Lock()
+	defer m.registryWrite.Unlock()
+
+	next := m.snapshot().clone()
+	if err := change(next); err != nil {
+		return err
+	}
+	m.registry.Store(next)
+	return nil
+}
+
+// Seal freezes the mediator's command handlers, query handlers and event
+// processors. Registering or unregistering one afterwards fails with
+// ErrRegistrySealed. Call it once the application has finished wiring itself
+// up, so nothing can change what handles a message while it runs. Middleware
+// can still be added.
+func (m *Mediator) Seal() {
+	_ = m.updateRegistry(func(r *registry) error {
+		r.sealed = true
+		return nil
+	})
+}
+
+// Sealed reports whether Seal has been called.
+func (m *Mediator) Sealed() bool {
+	return m.snapshot().sealed
+}
+
+func (r *registry) commandHandler(cmdType reflect.Type) (ResultCommandHandler, bool) {
+	c, ok := r.commandHandlers[cmdType]
+	if !ok {
+		return nil, false
+	}
+	return c.handler, true
+}
+
+// processorsFor returns the processors evt is delivered to: those registered
+// for its exact type first, then the matching wildcard subscriptions.
+func (r *registry) processorsFor(evt Event) []*processorRegistration {
+	exact := r.eventProcessors[reflect.TypeOf(evt)]
+	processors := make([]*processorRegistration, 0, len(exact)+len(r.wildcards))
+	processors = append(processors, exact...)
+	for _, w := range r.wildcards {
+		if w.matches(evt) {
+			processors = append(processors, w.registration)
+		}
+	}
+	return processors
+}
+
+// invoke runs handler on msg through the command middleware. Middleware only
+// sees the error, so the handler's result is carried around it.
+func (r *registry) invoke(ctx context.Context, msg Command, handler ResultCommandHandler) (any, error) {
+	var result any
+	err := r.wrapCommandHandler(func(ctx context.Context, cmd Command) error {
+		var e error
+		result, e = handler(ctx, cmd)
+		return e
+	})(ctx, msg)
+	return result, err
+}
+
+func (r *registry) wrapCommandHandler(handler ContextCommandHandler) ContextCommandHandler {
+	for i := len(r.commandMiddleware) - 1; i >= 0; i-- {
+		handler = r.commandMiddleware[i](handler)
+	}
+	return handler
+}
+
+func (r *registry) wrapEventProcessor(processor ContextEventProcessor) ContextEventProcessor {
+	for i := len(r.eventMiddleware) - 1; i >= 0; i-- {
+		processor = r.eventMiddleware[i](processor)
+	}
+	return processor
+}
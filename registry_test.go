@@ -0,0 +1,89 @@
+package conqueress
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentRegistrationAndDispatch(t *testing.T) {
+	mediator := NewMediator(false, WithWorkers(4))
+	require.Nil(t, RegisterCommandHandler[TestCmd](mediator, func(cmd Command) error { return nil }))
+	_, err := mediator.SubscribeAll(func(ctx context.Context, evt Event) error { return nil })
+	require.Nil(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_ = mediator.DispatchSync(TestCmd{v2: j}, nil)
+				_ = mediator.PublishSync(TestEvent{})
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				reg, err := mediator.Subscribe(reflect.TypeOf(TestEvent{}), func(ctx context.Context, evt Event) error {
+					return nil
+				}, WithProcessorName(fmt.Sprintf("p-%d-%d", i, j)))
+				if assert.Nil(t, err) {
+					assert.Nil(t, reg.Unregister())
+				}
+				mediator.UseEvents(func(next ContextEventProcessor) ContextEventProcessor { return next })
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestSeal(t *testing.T) {
+	var (
+		mediator     *Mediator
+		registration *Registration
+		handler      = &TestCmdHandler{}
+	)
+	ensure.That("a sealed mediator refuses registration changes but keeps working", func(s *ensure.Scenario) {
+		s.Given("a mediator with a command handler and a processor", func() {
+			mediator = NewMediator(false)
+			_ = RegisterCommandHandler[TestCmd](mediator, handler.Handle)
+			registration, _ = mediator.Subscribe(reflect.TypeOf(TestEvent{}), func(ctx context.Context, evt Event) error {
+				return nil
+			})
+		})
+
+		s.When("I seal it", func() {
+			mediator.Seal()
+		})
+
+		s.Then("it should report being sealed", func() {
+			assert.True(t, mediator.Sealed())
+		})
+
+		s.And("new registrations should be refused", func() {
+			assert.ErrorIs(t, RegisterCommandHandler[partitionedCmd](mediator, handler.Handle), ErrRegistrySealed)
+			assert.ErrorIs(t, RegisterQueryHandler[stockLevelQuery](mediator, func(ctx context.Context, q stockLevelQuery) (int, error) {
+				return 0, nil
+			}), ErrRegistrySealed)
+			_, err := mediator.SubscribeAll(func(ctx context.Context, evt Event) error { return nil })
+			assert.ErrorIs(t, err, ErrRegistrySealed)
+		})
+
+		s.And("existing registrations should not be removable", func() {
+			assert.ErrorIs(t, registration.Unregister(), ErrRegistrySealed)
+		})
+
+		s.And("dispatching and publishing should still work", func() {
+			assert.Nil(t, mediator.DispatchSync(TestCmd{}, nil))
+			assert.Nil(t, mediator.PublishSync(TestEvent{}))
+			assert.Len(t, handler.Received(), 1)
+		})
+	}, t)
+}
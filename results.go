@@ -0,0 +1,85 @@
+package conqueress
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// CommandResult is the standard result of a command that wrote to an
+// aggregate. AggregateId is the aggregate the command wrote to, Version is
+// the version of the aggregate's stream after the write, and Position is the
+// store's position for the last event written, which a caller can wait for a
+// read model to reach. Position is zero when the store does not report one.
+type CommandResult struct {
+	AggregateId string
+	Version     int
+	Position    int64
+}
+
+// CommandOutcome is what a command produced: the result its handler returned,
+// if any, and its error.
+type CommandOutcome struct {
+	Result any
+	Err    error
+}
+
+// ResultCommandHandler is a ContextCommandHandler that also returns a result.
+// Handlers registered any other way return a nil result.
+type ResultCommandHandler func(ctx context.Context, cmd Command) (any, error)
+
+func (h ContextCommandHandler) withResult() ResultCommandHandler {
+	return func(ctx context.Context, cmd Command) (any, error) {
+		return nil, h(ctx, cmd)
+	}
+}
+
+// RegisterCommandHandlerFor registers a handler for commands of type C that
+// returns an R, which DispatchFor hands back to the caller.
+func RegisterCommandHandlerFor[C Command, R any](m *Mediator, handler func(ctx context.Context, cmd C) (R, error)) error {
+	var c C
+	_, err := m.handle(reflect.TypeOf(c), &commandRegistration{
+		handler: func(ctx context.Context, cmd Command) (any, error) {
+			typed, err := as[C](cmd)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, typed)
+		},
+		resultType: reflect.TypeOf((*R)(nil)).Elem(),
+	})
+	return err
+}
+
+// DispatchFor runs the handler for cmd on the calling goroutine and returns
+// its result as an R. It fails if the handler returned something that is not
+// an R, and returns the zero R if the handler returned no result.
+func DispatchFor[C Command, R any](ctx context.Context, m *Mediator, cmd C) (R, error) {
+	var zero R
+
+	result, err := m.DispatchSyncWithResult(ctx, cmd)
+	if err != nil {
+		return zero, err
+	}
+	if result == nil {
+		return zero, nil
+	}
+
+	r, ok := result.(R)
+	if !ok {
+		return zero, fmt.Errorf("command %v returned %T, not %v", reflect.TypeOf(cmd), result, reflect.TypeOf((*R)(nil)).Elem())
+	}
+	return r, nil
+}
+
+// DispatchWithResult queues cmd like DispatchContext, and sends its outcome,
+// including the handler's result, to results once it has run.
+func (m *Mediator) DispatchWithResult(ctx context.Context, cmd Command, results chan CommandOutcome) CommandSubmissionError {
+	return m.dispatch(ctx, queuedCommand{ctx: ctx, cmd: cmd, resultResponse: results})
+}
+
+// DispatchSyncWithResult runs the handler for cmd on the calling goroutine
+// like DispatchSyncContext, and returns its result as well as its error.
+func (m *Mediator) DispatchSyncWithResult(ctx context.Context, cmd Command) (any, error) {
+	return m.dispatchSync(ctx, cmd)
+}
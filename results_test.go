@@ -0,0 +1,112 @@
+package conqueress
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type createWidget struct {
+	name string
+}
+
+func TestDispatchFor(t *testing.T) {
+	var (
+		mediator *Mediator
+		seen     []Command
+		result   CommandResult
+		err      error
+	)
+	ensure.That("a command's result is returned to the caller through the middleware", func(s *ensure.Scenario) {
+		s.Given("a mediator with a result handler and a middleware", func() {
+			mediator = NewMediator(false)
+			require.Nil(t, RegisterCommandHandlerFor(mediator, func(ctx context.Context, cmd createWidget) (CommandResult, error) {
+				return CommandResult{AggregateId: cmd.name, Version: 1}, nil
+			}))
+			mediator.Use(func(next ContextCommandHandler) ContextCommandHandler {
+				return func(ctx context.Context, cmd Command) error {
+					seen = append(seen, cmd)
+					return next(ctx, cmd)
+				}
+			})
+		})
+
+		s.When("I dispatch the command", func() {
+			result, err = DispatchFor[createWidget, CommandResult](context.Background(), mediator, createWidget{"widget"})
+		})
+
+		s.Then("its result should be returned", func() {
+			assert.Nil(t, err)
+			assert.Equal(t, CommandResult{AggregateId: "widget", Version: 1}, result)
+			assert.Equal(t, []Command{createWidget{"widget"}}, seen)
+		})
+	}, t)
+
+	ensure.That("a result of the wrong type is reported", func(s *ensure.Scenario) {
+		s.Given("a mediator whose handler returns a string", func() {
+			mediator = NewMediator(false)
+			require.Nil(t, RegisterCommandHandlerFor(mediator, func(ctx context.Context, cmd createWidget) (string, error) {
+				return cmd.name, nil
+			}))
+		})
+
+		s.When("I ask for a CommandResult", func() {
+			result, err = DispatchFor[createWidget, CommandResult](context.Background(), mediator, createWidget{"widget"})
+		})
+
+		s.Then("it should fail", func() {
+			assert.NotNil(t, err)
+		})
+	}, t)
+
+	ensure.That("a handler without a result returns the zero value", func(s *ensure.Scenario) {
+		s.Given("a mediator with a plain handler", func() {
+			mediator = NewMediator(false)
+			_ = RegisterTypedCommandHandler(mediator, func(cmd createWidget) error { return nil })
+		})
+
+		s.When("I dispatch for a result", func() {
+			result, err = DispatchFor[createWidget, CommandResult](context.Background(), mediator, createWidget{"widget"})
+		})
+
+		s.Then("the result should be empty", func() {
+			assert.Nil(t, err)
+			assert.Equal(t, CommandResult{}, result)
+		})
+	}, t)
+}
+
+func TestDispatchWithResult(t *testing.T) {
+	var (
+		mediator *Mediator
+		outcomes chan CommandOutcome
+		outcome  CommandOutcome
+	)
+	ensure.That("a queued command sends its result on the response channel", func(s *ensure.Scenario) {
+		s.Given("a mediator with a result handler", func() {
+			mediator = NewMediator(false)
+			outcomes = make(chan CommandOutcome, 1)
+			require.Nil(t, RegisterCommandHandlerFor(mediator, func(ctx context.Context, cmd createWidget) (CommandResult, error) {
+				return CommandResult{AggregateId: cmd.name, Version: 3, Position: 7}, nil
+			}))
+		})
+
+		s.When("I dispatch the command", func() {
+			require.Nil(t, mediator.DispatchWithResult(context.Background(), createWidget{"widget"}, outcomes))
+			select {
+			case outcome = <-outcomes:
+			case <-time.After(time.Second):
+				t.Fatal("no outcome received")
+			}
+		})
+
+		s.Then("the outcome should carry the result", func() {
+			assert.Nil(t, outcome.Err)
+			assert.Equal(t, CommandResult{AggregateId: "widget", Version: 3, Position: 7}, outcome.Result)
+		})
+	}, t)
+}
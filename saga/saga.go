@@ -0,0 +1,216 @@
+// Package saga coordinates long-running business processes across
+// aggregates. A saga reacts to events, keeps its own state for each instance
+// of the process, and moves the process on by dispatching commands.
+//
+// Each instance is identified by a correlation ID taken from the events it
+// handles. Handlers receive the instance's state through a Context, change
+// it, and ask for commands and timeouts; the saga saves the state and only
+// then dispatches what was asked for. A handler may run more than once for
+// the same event, if saving the state conflicts with a concurrent handler or
+// the event is redelivered, so the commands a saga dispatches should be safe
+// to repeat, for example by carrying a cqrs.IdentifiedCommand ID.
+//
+// The commands and timeouts a saga dispatches carry the correlation ID of the
+// event or timeout its handler ran for, so the whole process shares one.
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+
+	cqrs "github.com/iamkoch/conqueress"
+)
+
+const maxConflictRetries = 5
+
+// Timeout is the command a saga schedules for itself with
+// Context.RequestTimeout. It is dispatched through the mediator's scheduler,
+// so a durable scheduler must have it in its type map, as Timeout[S] for the
+// saga's state type.
+type Timeout[S any] struct {
+	CorrelationId string
+	Name          string
+}
+
+// Saga routes events and timeouts to the instances of one process, whose
+// state is of type S.
+type Saga[S any] struct {
+	name     string
+	mediator *cqrs.Mediator
+	store    StateStore[S]
+
+	mu       sync.RWMutex
+	timeouts map[string]func(c *Context[S]) error
+}
+
+// New creates a saga and registers the handler for its timeouts with m. Only
+// one saga per state type can be registered with a mediator.
+func New[S any](m *cqrs.Mediator, name string, store StateStore[S]) (*Saga[S], error) {
+	s := &Saga[S]{
+		name:     name,
+		mediator: m,
+		store:    store,
+		timeouts: make(map[string]func(c *Context[S]) error),
+	}
+
+	_, err := cqrs.Handle(m, s.handleTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("registering timeouts for saga %s: %w", name, err)
+	}
+	return s, nil
+}
+
+// Name returns the name the saga was created with.
+func (s *Saga[S]) Name() string {
+	return s.name
+}
+
+// StartedBy subscribes the saga to events of type E, which start a new
+// instance when there is none for the correlation ID correlate returns, and
+// are handled by the existing instance otherwise.
+func StartedBy[E cqrs.Event, S any](s *Saga[S], correlate func(evt E) string, handler func(c *Context[S], evt E) error, opts ...cqrs.ProcessorOption) (*cqrs.Registration, error) {
+	return subscribe(s, correlate, handler, true, opts)
+}
+
+// Handle subscribes the saga to events of type E for instances that have
+// already started. Events for an instance that does not exist, or has
+// completed, are ignored.
+func Handle[E cqrs.Event, S any](s *Saga[S], correlate func(evt E) string, handler func(c *Context[S], evt E) error, opts ...cqrs.ProcessorOption) (*cqrs.Registration, error) {
+	return subscribe(s, correlate, handler, false, opts)
+}
+
+func subscribe[E cqrs.Event, S any](s *Saga[S], correlate func(evt E) string, handler func(c *Context[S], evt E) error, starts bool, opts []cqrs.ProcessorOption) (*cqrs.Registration, error) {
+	var e E
+	name := fmt.Sprintf("%s:%v", s.name, reflect.TypeOf(e))
+	opts = append([]cqrs.ProcessorOption{cqrs.WithProcessorName(name)}, opts...)
+
+	return cqrs.Subscribe(s.mediator, func(ctx context.Context, evt E) error {
+		return s.run(ctx, correlate(evt), starts, func(c *Context[S]) error {
+			return handler(c, evt)
+		})
+	}, opts...)
+}
+
+// OnTimeout sets the handler for timeouts requested with the given name.
+func (s *Saga[S]) OnTimeout(name string, handler func(c *Context[S]) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timeouts[name] = handler
+}
+
+func (s *Saga[S]) handleTimeout(ctx context.Context, t Timeout[S]) error {
+	s.mu.RLock()
+	handler, ok := s.timeouts[t.Name]
+	s.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("saga %s has no handler for timeout %s", s.name, t.Name)
+	}
+	return s.run(ctx, t.CorrelationId, false, handler)
+}
+
+// run loads the instance, runs handle on it, saves it, and then dispatches
+// the commands and timeouts handle asked for. It starts again from a fresh
+// load when the save conflicts with a concurrent one.
+func (s *Saga[S]) run(ctx context.Context, id string, starts bool, handle func(c *Context[S]) error) error {
+	if id == "" {
+		return fmt.Errorf("saga %s: empty correlation ID", s.name)
+	}
+
+	for attempt := 0; ; attempt++ {
+		state, version, err := s.store.Load(ctx, id)
+		if err != nil {
+			return err
+		}
+		if version == -1 && !starts {
+			slog.With(
+				"saga", s.name,
+				"correlationId", id,
+			).Debug("Ignoring message for saga instance that is not running")
+			return nil
+		}
+
+		c := &Context[S]{ctx: ctx, id: id, State: state}
+		if err = handle(c); err != nil {
+			return err
+		}
+
+		if c.completed {
+			err = s.store.Delete(ctx, id)
+		} else {
+			err = s.store.Save(ctx, id, c.State, version)
+		}
+		if errors.Is(err, ErrConcurrency) && attempt < maxConflictRetries {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		return s.dispatch(ctx, c)
+	}
+}
+
+func (s *Saga[S]) dispatch(ctx context.Context, c *Context[S]) error {
+	var errs []error
+	for _, cmd := range c.commands {
+		if err := s.mediator.DispatchContext(ctx, cmd, nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, t := range c.timeouts {
+		if _, err := s.mediator.DispatchAfter(ctx, Timeout[S]{c.id, t.name}, t.after); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type requestedTimeout struct {
+	name  string
+	after time.Duration
+}
+
+// Context is what a saga handler works with: the instance's state, which it
+// may change, and the means to move the process on.
+type Context[S any] struct {
+	State S
+
+	ctx       context.Context
+	id        string
+	commands  []cqrs.Command
+	timeouts  []requestedTimeout
+	completed bool
+}
+
+// Context returns the context the event or timeout was delivered with.
+func (c *Context[S]) Context() context.Context {
+	return c.ctx
+}
+
+// CorrelationId returns the ID of the instance being handled.
+func (c *Context[S]) CorrelationId() string {
+	return c.id
+}
+
+// Dispatch asks for cmd to be dispatched once the instance's state is saved.
+func (c *Context[S]) Dispatch(cmd cqrs.Command) {
+	c.commands = append(c.commands, cmd)
+}
+
+// RequestTimeout asks for the handler registered with OnTimeout for name to
+// run on this instance once after has passed. The mediator needs a
+// scheduler. A timeout that arrives after the instance completes is ignored.
+func (c *Context[S]) RequestTimeout(name string, after time.Duration) {
+	c.timeouts = append(c.timeouts, requestedTimeout{name, after})
+}
+
+// Complete ends the instance. Its state is deleted instead of saved, and
+// later events and timeouts for it are ignored.
+func (c *Context[S]) Complete() {
+	c.completed = true
+}
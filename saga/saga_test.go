@@ -0,0 +1,141 @@
+package saga
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cqrs "github.com/iamkoch/conqueress"
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type orderPlaced struct {
+	*cqrs.BaseEvent
+	OrderId string
+	Sku     string
+}
+
+type stockReserved struct {
+	*cqrs.BaseEvent
+	OrderId string
+}
+
+type reserveStock struct {
+	OrderId string
+	Sku     string
+}
+
+type cancelOrder struct {
+	OrderId string
+}
+
+type orderState struct {
+	Sku      string
+	Reserved bool
+}
+
+func TestSaga(t *testing.T) {
+	var (
+		mediator  *cqrs.Mediator
+		store     *InMemoryStateStore[orderState]
+		reserved  chan reserveStock
+		cancelled chan cancelOrder
+	)
+	setup := func() {
+		mediator = cqrs.NewMediator(false, cqrs.WithScheduler(cqrs.NewInMemoryCommandScheduler(), 5*time.Millisecond))
+		store = NewInMemoryStateStore[orderState]()
+		reserved = make(chan reserveStock, 1)
+		cancelled = make(chan cancelOrder, 1)
+		_ = cqrs.RegisterTypedCommandHandler(mediator, func(cmd reserveStock) error {
+			reserved <- cmd
+			return nil
+		})
+		_ = cqrs.RegisterTypedCommandHandler(mediator, func(cmd cancelOrder) error {
+			cancelled <- cmd
+			return nil
+		})
+
+		s, err := New[orderState](mediator, "orders", store)
+		require.Nil(t, err)
+		_, err = StartedBy(s, func(e orderPlaced) string { return e.OrderId }, func(c *Context[orderState], e orderPlaced) error {
+			c.State.Sku = e.Sku
+			c.Dispatch(reserveStock{e.OrderId, e.Sku})
+			c.RequestTimeout("reservation", 20*time.Millisecond)
+			return nil
+		})
+		require.Nil(t, err)
+		_, err = Handle(s, func(e stockReserved) string { return e.OrderId }, func(c *Context[orderState], e stockReserved) error {
+			c.State.Reserved = true
+			c.Complete()
+			return nil
+		})
+		require.Nil(t, err)
+		s.OnTimeout("reservation", func(c *Context[orderState]) error {
+			c.Dispatch(cancelOrder{c.CorrelationId()})
+			c.Complete()
+			return nil
+		})
+	}
+	placed := func(id string) orderPlaced {
+		return cqrs.NewEvent[orderPlaced](func(e *orderPlaced) { e.OrderId, e.Sku = id, "widget" })
+	}
+
+	ensure.That("a saga starts on its first event and dispatches commands", func(s *ensure.Scenario) {
+		s.Given("a running saga", setup)
+
+		s.When("an order is placed", func() {
+			require.Nil(t, mediator.PublishSync(placed("order-1")))
+		})
+
+		s.Then("stock should be reserved and the instance saved", func() {
+			select {
+			case cmd := <-reserved:
+				assert.Equal(t, reserveStock{"order-1", "widget"}, cmd)
+			case <-time.After(time.Second):
+				t.Fatal("no command dispatched")
+			}
+			state, version, err := store.Load(context.Background(), "order-1")
+			assert.Nil(t, err)
+			assert.Equal(t, 0, version)
+			assert.Equal(t, orderState{Sku: "widget"}, state)
+		})
+
+		s.And("completing it should delete its state", func() {
+			require.Nil(t, mediator.PublishSync(cqrs.NewEvent[stockReserved](func(e *stockReserved) { e.OrderId = "order-1" })))
+			_, version, _ := store.Load(context.Background(), "order-1")
+			assert.Equal(t, -1, version)
+		})
+	}, t)
+
+	ensure.That("a timeout runs on an instance that has not completed", func(s *ensure.Scenario) {
+		s.Given("a running saga", setup)
+
+		s.When("an order is placed and stock is never reserved", func() {
+			require.Nil(t, mediator.PublishSync(placed("order-2")))
+		})
+
+		s.Then("the order should be cancelled", func() {
+			select {
+			case cmd := <-cancelled:
+				assert.Equal(t, cancelOrder{"order-2"}, cmd)
+			case <-time.After(time.Second):
+				t.Fatal("timeout was not handled")
+			}
+		})
+	}, t)
+
+	ensure.That("events for an instance that is not running are ignored", func(s *ensure.Scenario) {
+		s.Given("a running saga", setup)
+
+		s.When("stock is reserved for an unknown order", func() {
+			require.Nil(t, mediator.PublishSync(cqrs.NewEvent[stockReserved](func(e *stockReserved) { e.OrderId = "order-3" })))
+		})
+
+		s.Then("no instance should be created", func() {
+			_, version, _ := store.Load(context.Background(), "order-3")
+			assert.Equal(t, -1, version)
+		})
+	}, t)
+}
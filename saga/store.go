@@ -0,0 +1,133 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/iamkoch/conqueress/domain"
+	"github.com/iamkoch/conqueress/eventstore"
+	"github.com/iamkoch/conqueress/guid"
+)
+
+// ErrConcurrency is returned by StateStore.Save when the instance has been
+// saved by someone else since it was loaded.
+var ErrConcurrency = errors.New("saga instance was changed concurrently")
+
+// StateStore persists the state of saga instances by correlation ID.
+//
+// Load returns the instance's state and version, or, for an instance that
+// does not exist, fresh state and a version of -1. Save stores state if the
+// instance is still at expectedVersion, where -1 means it must not exist yet,
+// and fails with ErrConcurrency otherwise. Delete removes a completed
+// instance.
+type StateStore[S any] interface {
+	Load(ctx context.Context, id string) (state S, version int, err error)
+	Save(ctx context.Context, id string, state S, expectedVersion int) error
+	Delete(ctx context.Context, id string) error
+}
+
+type inMemoryInstance[S any] struct {
+	state   S
+	version int
+}
+
+// InMemoryStateStore keeps saga state in memory. It stores the state value it
+// is given, so state that holds pointers, maps or slices is shared with the
+// handler that saved it. It is safe for concurrent use.
+type InMemoryStateStore[S any] struct {
+	mu        sync.Mutex
+	instances map[string]inMemoryInstance[S]
+}
+
+func NewInMemoryStateStore[S any]() *InMemoryStateStore[S] {
+	return &InMemoryStateStore[S]{instances: make(map[string]inMemoryInstance[S])}
+}
+
+func (s *InMemoryStateStore[S]) Load(_ context.Context, id string) (S, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	instance, ok := s.instances[id]
+	if !ok {
+		var state S
+		return state, -1, nil
+	}
+	return instance.state, instance.version, nil
+}
+
+func (s *InMemoryStateStore[S]) Save(_ context.Context, id string, state S, expectedVersion int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.instances[id]
+	if (!ok && expectedVersion != -1) || (ok && current.version != expectedVersion) {
+		return ErrConcurrency
+	}
+	s.instances[id] = inMemoryInstance[S]{state, expectedVersion + 1}
+	return nil
+}
+
+func (s *InMemoryStateStore[S]) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.instances, id)
+	return nil
+}
+
+// versioned is implemented by aggregates built on domain.AggregateRootBase.
+type versioned interface {
+	Version() int
+}
+
+type repositoryStateStore[T domain.IAggregate] struct {
+	repo   eventstore.Repository[T]
+	create func(id guid.Guid) T
+}
+
+// NewRepositoryStateStore event-sources saga state through repo. The state is
+// an aggregate whose ID is the correlation ID, which must therefore be a
+// guid, and handlers change it by applying events to it. create returns a new
+// aggregate for an instance that has not started yet.
+//
+// An event stream cannot be deleted, so completing an instance leaves its
+// events in place. Record completion with an event of your own if handlers
+// need to ignore later events for a completed instance.
+func NewRepositoryStateStore[T domain.IAggregate](repo eventstore.Repository[T], create func(id guid.Guid) T) StateStore[T] {
+	return repositoryStateStore[T]{repo, create}
+}
+
+func (r repositoryStateStore[T]) Load(ctx context.Context, id string) (T, int, error) {
+	aid, err := guid.FromString(id)
+	if err != nil {
+		var t T
+		return t, 0, err
+	}
+
+	agg, err := r.repo.GetByIdContext(ctx, aid)
+	if errors.Is(err, eventstore.ErrAggregateNotFound) {
+		return r.create(aid), -1, nil
+	}
+	if err != nil {
+		return agg, 0, err
+	}
+
+	version := 0
+	if v, ok := any(agg).(versioned); ok {
+		version = v.Version()
+	}
+	return agg, version, nil
+}
+
+func (r repositoryStateStore[T]) Save(ctx context.Context, _ string, state T, expectedVersion int) error {
+	if len(state.UncommittedEvents()) == 0 {
+		return nil
+	}
+	err := r.repo.SaveContext(ctx, state, expectedVersion)
+	if errors.Is(err, eventstore.ErrConcurrencyException) {
+		return ErrConcurrency
+	}
+	return err
+}
+
+func (r repositoryStateStore[T]) Delete(context.Context, string) error {
+	return nil
+}
@@ -0,0 +1,141 @@
+package saga
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	cqrs "github.com/iamkoch/conqueress"
+	"github.com/iamkoch/conqueress/domain"
+	"github.com/iamkoch/conqueress/eventstore"
+	"github.com/iamkoch/conqueress/eventstore/inmemory"
+	"github.com/iamkoch/conqueress/guid"
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type shipmentNoted struct {
+	*cqrs.BaseEvent
+	ShipmentId guid.Guid
+	Note       string
+}
+
+type shipment struct {
+	domain.AggregateRootBase[guid.Guid]
+	notes []string
+}
+
+func newShipment(id guid.Guid) *shipment {
+	s := &shipment{AggregateRootBase: domain.NewAggregate[guid.Guid]()}
+	s.SetId(id)
+	s.SetInnerApply(s.apply)
+	return s
+}
+
+func (s *shipment) apply(e cqrs.Event) {
+	s.SetVersion(e.Version())
+	if noted, ok := e.(shipmentNoted); ok {
+		s.SetId(noted.ShipmentId)
+		s.notes = append(s.notes, noted.Note)
+	}
+}
+
+func (s *shipment) note(note string) {
+	s.ApplyChange(cqrs.NewEvent[shipmentNoted](func(e *shipmentNoted) {
+		e.ShipmentId = s.Id()
+		e.Note = note
+	}))
+}
+
+func TestRepositoryStateStoreConflicts(t *testing.T) {
+	var (
+		store        StateStore[*shipment]
+		events       eventstore.IGenericIDEventStore[guid.Guid]
+		id           string
+		first, other *shipment
+		firstVersion int
+		otherVersion int
+		err          error
+	)
+	setup := func() {
+		mediator := cqrs.NewMediator(false)
+		mediator.RegisterEventHandler(reflect.TypeOf(shipmentNoted{}), func(e cqrs.Event) error { return nil })
+		events = inmemory.NewInMemoryEventStore[guid.Guid](mediator)
+		repo := eventstore.NewRepository[*shipment](events, func() *shipment {
+			return newShipment(guid.Guid{})
+		})
+		store = NewRepositoryStateStore[*shipment](repo, newShipment)
+		id = guid.New().String()
+	}
+
+	ensure.That("two instances racing to start under one correlation ID conflict", func(s *ensure.Scenario) {
+		s.Given("two handlers that have both loaded an instance that does not exist", func() {
+			setup()
+			first, firstVersion, err = store.Load(context.Background(), id)
+			require.Nil(t, err)
+			other, otherVersion, err = store.Load(context.Background(), id)
+			require.Nil(t, err)
+		})
+
+		s.When("both save it", func() {
+			first.note("first")
+			other.note("other")
+			require.Nil(t, store.Save(context.Background(), id, first, firstVersion))
+			err = store.Save(context.Background(), id, other, otherVersion)
+		})
+
+		s.Then("the second save should conflict", func() {
+			assert.Equal(t, -1, otherVersion)
+			assert.ErrorIs(t, err, ErrConcurrency)
+		})
+	}, t)
+
+	ensure.That("saving state loaded before another save conflicts", func(s *ensure.Scenario) {
+		s.Given("an instance loaded by two handlers", func() {
+			setup()
+			started, version, err := store.Load(context.Background(), id)
+			require.Nil(t, err)
+			started.note("started")
+			require.Nil(t, store.Save(context.Background(), id, started, version))
+
+			first, firstVersion, err = store.Load(context.Background(), id)
+			require.Nil(t, err)
+			other, otherVersion, err = store.Load(context.Background(), id)
+			require.Nil(t, err)
+		})
+
+		s.When("both save it", func() {
+			first.note("first")
+			other.note("other")
+			require.Nil(t, store.Save(context.Background(), id, first, firstVersion))
+			err = store.Save(context.Background(), id, other, otherVersion)
+		})
+
+		s.Then("the second save should conflict", func() {
+			assert.ErrorIs(t, err, ErrConcurrency)
+		})
+	}, t)
+
+	ensure.That("state is saved under the context the saga handles its event with", func(s *ensure.Scenario) {
+		s.Given("a new instance", func() {
+			setup()
+			first, firstVersion, err = store.Load(context.Background(), id)
+			require.Nil(t, err)
+		})
+
+		s.When("it is saved while handling an event of a correlated command", func() {
+			first.note("started")
+			ctx := cqrs.ContextWithCorrelation(context.Background(), "order-1", "place-order-1")
+			err = store.Save(ctx, id, first, firstVersion)
+		})
+
+		s.Then("its events should carry the correlation and causation", func() {
+			require.Nil(t, err)
+			saved := events.GetEventsForAggregate(guid.MustFromString(id))
+			require.Len(t, saved, 1)
+			assert.Equal(t, "order-1", cqrs.CorrelationIdOf(saved[0]))
+			assert.Equal(t, "place-order-1", cqrs.CausationIdOf(saved[0]))
+		})
+	}, t)
+}
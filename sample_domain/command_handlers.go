@@ -1,7 +1,6 @@
 package sample_domain
 
 import (
-	cqrs "github.com/iamkoch/conqueress"
 	"github.com/iamkoch/conqueress/eventstore"
 )
 
@@ -22,8 +21,7 @@ func (i InventoryCommandHandlers) Handle(item CreateInventoryItem) error {
 	return nil
 }
 
-func (i InventoryCommandHandlers) HandleCreateInventoryItem(cmd cqrs.Command) error {
-	item := cmd.(CreateInventoryItem)
+func (i InventoryCommandHandlers) HandleCreateInventoryItem(item CreateInventoryItem) error {
 	inventoryItem := NewInventoryItem(item.InventoryItemId, item.Name)
 	err := i.repository.Save(inventoryItem, -1)
 	if err != nil {
@@ -32,8 +30,7 @@ func (i InventoryCommandHandlers) HandleCreateInventoryItem(cmd cqrs.Command) er
 	return nil
 }
 
-func (i InventoryCommandHandlers) HandleRenameInventoryItem(cmd cqrs.Command) error {
-	item := cmd.(RenameInventoryItem)
+func (i InventoryCommandHandlers) HandleRenameInventoryItem(item RenameInventoryItem) error {
 	inventoryItem, err := i.repository.GetById(item.InventoryItemId)
 	if err != nil {
 		return err
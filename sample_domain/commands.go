@@ -24,3 +24,11 @@ func NewRenameInventoryItem(id guid.Guid, newName string) RenameInventoryItem {
 		NewName:         newName,
 	}
 }
+
+func (c CreateInventoryItem) AggregateID() string {
+	return c.InventoryItemId.String()
+}
+
+func (c RenameInventoryItem) AggregateID() string {
+	return c.InventoryItemId.String()
+}
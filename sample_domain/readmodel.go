@@ -11,9 +11,7 @@ type InventoryItemReadModelHandler struct {
 	cqrs.BaseProjectionHandler[*InventoryItemReadModel]
 }
 
-func (i InventoryItemReadModelHandler) HandleCreated(e cqrs.Event) error {
-	iic := e.(InventoryItemCreated)
-
+func (i InventoryItemReadModelHandler) HandleCreated(iic InventoryItemCreated) error {
 	return i.UpdateProjection(iic.Id, iic, func(p *InventoryItemReadModel, e cqrs.Event) {
 		p.BaseProjection = cqrs.NewBaseProjection(
 			iic.Id,
@@ -23,9 +21,7 @@ func (i InventoryItemReadModelHandler) HandleCreated(e cqrs.Event) error {
 	})
 }
 
-func (i InventoryItemReadModelHandler) HandleRenamed(e cqrs.Event) error {
-	iir := e.(InventoryItemRenamed)
-
+func (i InventoryItemReadModelHandler) HandleRenamed(iir InventoryItemRenamed) error {
 	return i.UpdateProjection(iir.Id, iir, func(p *InventoryItemReadModel, e cqrs.Event) {
 		p.name = iir.NewName
 	})
@@ -0,0 +1,300 @@
+package conqueress
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/iamkoch/conqueress/guid"
+)
+
+const (
+	defaultSchedulerPollInterval = time.Second
+	schedulerBatchSize           = 100
+	schedulerLease               = time.Minute
+	defaultSchedulerMaxAttempts  = 5
+)
+
+var (
+	// ErrNoScheduler is returned by DispatchAt, DispatchAfter and
+	// CancelScheduled when the mediator was created without WithScheduler.
+	ErrNoScheduler = errors.New("no command scheduler configured")
+	// ErrScheduledCommandNotFound is returned when cancelling a scheduled
+	// command that does not exist, or has already been delivered.
+	ErrScheduledCommandNotFound = errors.New("scheduled command not found")
+)
+
+// ScheduledCommand is a command waiting in a CommandScheduler to be
+// dispatched at DueAt. Attempts counts how many times it has been claimed for
+// delivery. CorrelationId and CausationId are those of the context it was
+// scheduled with, which it is dispatched with in turn.
+type ScheduledCommand struct {
+	Id            string
+	Command       Command
+	DueAt         time.Time
+	Attempts      int
+	CorrelationId string
+	CausationId   string
+}
+
+// CommandScheduler stores commands until they are due.
+//
+// Due claims up to limit commands whose DueAt is not after now, and returns
+// them oldest first. When it fails part way, it returns the commands it has
+// claimed along with the error. Commands that cannot be decoded should be set
+// aside rather than fail the claim, so they do not hold back the rest.
+// Claiming moves a command's DueAt to now plus lease, so no other poller
+// receives it in the meantime, and it is delivered again if Complete is not
+// called before the lease runs out. Delivery is therefore at least once. The
+// commands Due returns carry the DueAt they had before they were claimed.
+type CommandScheduler interface {
+	Schedule(ctx context.Context, cmd ScheduledCommand) error
+	Cancel(ctx context.Context, id string) error
+	Due(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]ScheduledCommand, error)
+	Complete(ctx context.Context, id string) error
+}
+
+// WithScheduler lets the mediator dispatch commands in the future through
+// DispatchAt and DispatchAfter. The mediator polls scheduler every
+// pollInterval, or every second if pollInterval is not positive, and queues
+// the commands that are due like Dispatch does. Shutdown stops the polling
+// before it drains the queue.
+func WithScheduler(scheduler CommandScheduler, pollInterval time.Duration) MediatorOption {
+	return func(m *Mediator) {
+		if pollInterval <= 0 {
+			pollInterval = defaultSchedulerPollInterval
+		}
+		m.scheduler = scheduler
+		m.schedulerPollInterval = pollInterval
+	}
+}
+
+// WithScheduledCommandAttempts sets how many times the mediator tries a
+// scheduled command that fails to be dispatched or handled before it gives up
+// on it. A failed command is tried again when its lease runs out, a minute
+// after it was claimed. A command with no handler, or that fails validation,
+// is given up on at once. The default is 5.
+func WithScheduledCommandAttempts(n int) MediatorOption {
+	return func(m *Mediator) {
+		if n > 0 {
+			m.schedulerMaxAttempts = n
+		}
+	}
+}
+
+// DispatchAt stores cmd to be dispatched at the given time, and returns the
+// ID that cancels it. The command is checked for a handler and validated now,
+// as well as when it is dispatched.
+func (m *Mediator) DispatchAt(ctx context.Context, cmd Command, at time.Time) (string, error) {
+	if m.scheduler == nil {
+		return "", ErrNoScheduler
+	}
+
+	reg := m.snapshot()
+	if _, ok := reg.commandHandler(reflect.TypeOf(cmd)); !ok {
+		return "", ErrNoHandler
+	}
+	if err := reg.validate(cmd); err != nil {
+		return "", err
+	}
+
+	id := guid.New().String()
+	err := m.scheduler.Schedule(ctx, ScheduledCommand{
+		Id:            id,
+		Command:       cmd,
+		DueAt:         at.UTC(),
+		CorrelationId: CorrelationIdFrom(ctx),
+		CausationId:   CausationIdFrom(ctx),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	slog.With(
+		"type", reflect.TypeOf(cmd),
+		"command", cmd,
+		"id", id,
+		"at", at,
+	).Info("Scheduled command")
+	return id, nil
+}
+
+// DispatchAfter stores cmd to be dispatched once delay has passed, and
+// returns the ID that cancels it.
+func (m *Mediator) DispatchAfter(ctx context.Context, cmd Command, delay time.Duration) (string, error) {
+	return m.DispatchAt(ctx, cmd, time.Now().Add(delay))
+}
+
+// CancelScheduled removes a scheduled command before it is dispatched.
+func (m *Mediator) CancelScheduled(ctx context.Context, id string) error {
+	if m.scheduler == nil {
+		return ErrNoScheduler
+	}
+	return m.scheduler.Cancel(ctx, id)
+}
+
+// pollScheduler delivers due commands until stop is closed.
+func (m *Mediator) pollScheduler(stop chan struct{}) {
+	ticker := time.NewTicker(m.schedulerPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.deliverDue()
+		}
+	}
+}
+
+// deliverDue dispatches the commands that are due, all of them before it
+// waits for any to be handled, so a slow handler does not hold the rest of
+// the batch past its lease.
+func (m *Mediator) deliverDue() {
+	ctx := context.Background()
+	// A scheduler that fails part way returns the commands it had already
+	// claimed, and they are delivered rather than left until their lease
+	// runs out.
+	due, err := m.scheduler.Due(ctx, time.Now().UTC(), schedulerBatchSize, schedulerLease)
+	if err != nil {
+		slog.With(
+			"error", err,
+		).Error("Failed to read scheduled commands")
+	}
+
+	type delivery struct {
+		ctx  context.Context
+		sc   ScheduledCommand
+		resp chan CommandProcessingError
+	}
+	deliveries := make([]delivery, 0, len(due))
+	for _, sc := range due {
+		ctx := ctx
+		if sc.CorrelationId != "" || sc.CausationId != "" {
+			ctx = ContextWithCorrelation(ctx, sc.CorrelationId, sc.CausationId)
+		}
+		resp := make(chan CommandProcessingError, 1)
+		if err := m.dispatch(ctx, queuedCommand{ctx: ctx, cmd: sc.Command, synchronousResponse: resp}); err != nil {
+			m.settleScheduled(ctx, sc, err)
+			continue
+		}
+		deliveries = append(deliveries, delivery{ctx, sc, resp})
+	}
+
+	for _, d := range deliveries {
+		m.settleScheduled(d.ctx, d.sc, <-d.resp)
+	}
+}
+
+// settleScheduled completes a scheduled command once it has been handled, or
+// has failed in a way that trying again cannot fix, because it has no handler
+// or fails validation, or has failed schedulerMaxAttempts times. Otherwise it
+// is left to be delivered again when its lease runs out.
+func (m *Mediator) settleScheduled(ctx context.Context, sc ScheduledCommand, err error) {
+	if err != nil {
+		var verr *ValidationError
+		permanent := errors.Is(err, ErrNoHandler) || errors.As(err, &verr)
+		if !permanent && sc.Attempts < m.schedulerMaxAttempts {
+			slog.With(
+				"id", sc.Id,
+				"command", sc.Command,
+				"attempts", sc.Attempts,
+				"error", err,
+			).Warn("Scheduled command failed")
+			return
+		}
+		slog.With(
+			"id", sc.Id,
+			"command", sc.Command,
+			"attempts", sc.Attempts,
+			"error", err,
+		).Error("Giving up on scheduled command")
+	}
+	if err := m.scheduler.Complete(ctx, sc.Id); err != nil {
+		slog.With(
+			"id", sc.Id,
+			"error", err,
+		).Error("Failed to complete scheduled command")
+	}
+}
+
+// InMemoryCommandScheduler keeps scheduled commands in memory, so they are
+// lost when the process stops. It is safe for concurrent use.
+type InMemoryCommandScheduler struct {
+	mu       sync.Mutex
+	commands map[string]ScheduledCommand
+}
+
+func NewInMemoryCommandScheduler() *InMemoryCommandScheduler {
+	return &InMemoryCommandScheduler{commands: make(map[string]ScheduledCommand)}
+}
+
+func (s *InMemoryCommandScheduler) Schedule(_ context.Context, cmd ScheduledCommand) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands[cmd.Id] = cmd
+	return nil
+}
+
+func (s *InMemoryCommandScheduler) Cancel(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.commands[id]; !ok {
+		return ErrScheduledCommandNotFound
+	}
+	delete(s.commands, id)
+	return nil
+}
+
+func (s *InMemoryCommandScheduler) Due(_ context.Context, now time.Time, limit int, lease time.Duration) ([]ScheduledCommand, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	due := make([]ScheduledCommand, 0)
+	for _, cmd := range s.commands {
+		if !cmd.DueAt.After(now) {
+			due = append(due, cmd)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].DueAt.Before(due[j].DueAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	for i := range due {
+		due[i].Attempts++
+		claimed := due[i]
+		claimed.DueAt = now.Add(lease)
+		s.commands[claimed.Id] = claimed
+	}
+	return due, nil
+}
+
+func (s *InMemoryCommandScheduler) Complete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.commands, id)
+	return nil
+}
+
+// Pending returns the commands that have not been delivered yet, soonest
+// first.
+func (s *InMemoryCommandScheduler) Pending() []ScheduledCommand {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := make([]ScheduledCommand, 0, len(s.commands))
+	for _, cmd := range s.commands {
+		pending = append(pending, cmd)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].DueAt.Before(pending[j].DueAt)
+	})
+	return pending
+}
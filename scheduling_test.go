@@ -0,0 +1,287 @@
+package conqueress
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type expireReservation struct {
+	Sku string
+}
+
+func TestScheduledDispatch(t *testing.T) {
+	var (
+		mediator  *Mediator
+		scheduler *InMemoryCommandScheduler
+		handled   chan expireReservation
+		id        string
+		err       error
+	)
+	setup := func() {
+		scheduler = NewInMemoryCommandScheduler()
+		mediator = NewMediator(false, WithScheduler(scheduler, 5*time.Millisecond))
+		handled = make(chan expireReservation, 1)
+		_ = RegisterTypedCommandHandler(mediator, func(cmd expireReservation) error {
+			handled <- cmd
+			return nil
+		})
+	}
+
+	ensure.That("a command dispatched after a delay is handled once it is due", func(s *ensure.Scenario) {
+		s.Given("a mediator with a scheduler", setup)
+
+		s.When("I dispatch a command after a delay", func() {
+			id, err = mediator.DispatchAfter(context.Background(), expireReservation{"widget"}, 20*time.Millisecond)
+			require.Nil(t, err)
+		})
+
+		s.Then("it should be handled and removed from the scheduler", func() {
+			select {
+			case cmd := <-handled:
+				assert.Equal(t, expireReservation{"widget"}, cmd)
+			case <-time.After(time.Second):
+				t.Fatal("scheduled command was not handled")
+			}
+			assert.Eventually(t, func() bool { return len(scheduler.Pending()) == 0 }, time.Second, 5*time.Millisecond)
+		})
+	}, t)
+
+	ensure.That("a cancelled command is never handled", func(s *ensure.Scenario) {
+		s.Given("a mediator with a scheduled command", func() {
+			setup()
+			id, err = mediator.DispatchAfter(context.Background(), expireReservation{"widget"}, 20*time.Millisecond)
+			require.Nil(t, err)
+		})
+
+		s.When("I cancel it", func() {
+			err = mediator.CancelScheduled(context.Background(), id)
+		})
+
+		s.Then("it should not be handled", func() {
+			assert.Nil(t, err)
+			select {
+			case <-handled:
+				t.Fatal("cancelled command was handled")
+			case <-time.After(50 * time.Millisecond):
+			}
+			assert.ErrorIs(t, mediator.CancelScheduled(context.Background(), id), ErrScheduledCommandNotFound)
+		})
+	}, t)
+
+	ensure.That("commands still waiting survive shutdown in the scheduler", func(s *ensure.Scenario) {
+		s.Given("a mediator with a command due later", func() {
+			setup()
+			_, err = mediator.DispatchAfter(context.Background(), expireReservation{"widget"}, time.Hour)
+			require.Nil(t, err)
+		})
+
+		s.When("I shut the mediator down", func() {
+			err = mediator.Shutdown(context.Background())
+		})
+
+		s.Then("the command should still be pending", func() {
+			assert.Nil(t, err)
+			assert.Len(t, scheduler.Pending(), 1)
+		})
+	}, t)
+
+	ensure.That("scheduling without a scheduler fails", func(s *ensure.Scenario) {
+		s.Given("a mediator without a scheduler", func() {
+			mediator = NewMediator(false)
+			_ = RegisterTypedCommandHandler(mediator, func(cmd expireReservation) error { return nil })
+		})
+
+		s.When("I dispatch a command later", func() {
+			_, err = mediator.DispatchAfter(context.Background(), expireReservation{"widget"}, time.Second)
+		})
+
+		s.Then("it should fail", func() {
+			assert.ErrorIs(t, err, ErrNoScheduler)
+		})
+	}, t)
+}
+
+func TestInMemorySchedulerLeases(t *testing.T) {
+	var (
+		scheduler *InMemoryCommandScheduler
+		now       = time.Now()
+		first     []ScheduledCommand
+		second    []ScheduledCommand
+	)
+	ensure.That("a claimed command is redelivered only after its lease runs out", func(s *ensure.Scenario) {
+		s.Given("a scheduler with a due command", func() {
+			scheduler = NewInMemoryCommandScheduler()
+			_ = scheduler.Schedule(context.Background(), ScheduledCommand{Id: "1", Command: expireReservation{"widget"}, DueAt: now})
+		})
+
+		s.When("it is claimed twice within the lease", func() {
+			first, _ = scheduler.Due(context.Background(), now, 10, time.Minute)
+			second, _ = scheduler.Due(context.Background(), now.Add(time.Second), 10, time.Minute)
+		})
+
+		s.Then("only the first claim should receive it", func() {
+			require.Len(t, first, 1)
+			assert.Equal(t, 1, first[0].Attempts)
+			assert.Equal(t, now, first[0].DueAt)
+			assert.Empty(t, second)
+			again, _ := scheduler.Due(context.Background(), now.Add(2*time.Minute), 10, time.Minute)
+			require.Len(t, again, 1)
+			assert.Equal(t, 2, again[0].Attempts)
+		})
+	}, t)
+}
+
+func TestFailedScheduledCommands(t *testing.T) {
+	var (
+		mediator  *Mediator
+		scheduler *InMemoryCommandScheduler
+	)
+	setup := func(attempts int) {
+		scheduler = NewInMemoryCommandScheduler()
+		mediator = NewMediator(false, WithScheduler(scheduler, time.Hour), WithScheduledCommandAttempts(3))
+		_ = RegisterTypedCommandHandler(mediator, func(cmd expireReservation) error {
+			return errors.New("warehouse unavailable")
+		})
+		_ = scheduler.Schedule(context.Background(), ScheduledCommand{
+			Id:       "1",
+			Command:  expireReservation{"widget"},
+			DueAt:    time.Now().Add(-time.Second),
+			Attempts: attempts,
+		})
+	}
+
+	ensure.That("a scheduled command whose handler fails is kept to be tried again", func(s *ensure.Scenario) {
+		s.Given("a due command whose handler fails", func() {
+			setup(0)
+		})
+
+		s.When("the mediator delivers it", func() {
+			mediator.deliverDue()
+		})
+
+		s.Then("it should still be waiting, leased until it is tried again", func() {
+			pending := scheduler.Pending()
+			require.Len(t, pending, 1)
+			assert.Equal(t, 1, pending[0].Attempts)
+			assert.True(t, pending[0].DueAt.After(time.Now()))
+		})
+	}, t)
+
+	ensure.That("a scheduled command that keeps failing is given up on", func(s *ensure.Scenario) {
+		s.Given("a due command on its last attempt whose handler fails", func() {
+			setup(2)
+		})
+
+		s.When("the mediator delivers it", func() {
+			mediator.deliverDue()
+		})
+
+		s.Then("it should be removed from the scheduler", func() {
+			assert.Empty(t, scheduler.Pending())
+		})
+	}, t)
+
+	ensure.That("a scheduled command that fails validation is given up on at once", func(s *ensure.Scenario) {
+		s.Given("a due command that fails validation on its first attempt", func() {
+			setup(0)
+			_ = RegisterValidator(mediator, func(cmd expireReservation) error {
+				return errors.New("reservation already expired")
+			})
+		})
+
+		s.When("the mediator delivers it", func() {
+			mediator.deliverDue()
+		})
+
+		s.Then("it should be removed from the scheduler", func() {
+			assert.Empty(t, scheduler.Pending())
+		})
+	}, t)
+
+	ensure.That("a scheduled command with no handler is given up on at once", func(s *ensure.Scenario) {
+		s.Given("a due command that no handler is registered for", func() {
+			scheduler = NewInMemoryCommandScheduler()
+			mediator = NewMediator(false, WithScheduler(scheduler, time.Hour))
+			_ = scheduler.Schedule(context.Background(), ScheduledCommand{
+				Id:      "1",
+				Command: expireReservation{"widget"},
+				DueAt:   time.Now().Add(-time.Second),
+			})
+		})
+
+		s.When("the mediator delivers it", func() {
+			mediator.deliverDue()
+		})
+
+		s.Then("it should be removed from the scheduler", func() {
+			assert.Empty(t, scheduler.Pending())
+		})
+	}, t)
+
+	ensure.That("a scheduled command that cannot be dispatched is given up on after its last attempt", func(s *ensure.Scenario) {
+		s.Given("a due command on its last attempt and a mediator that is shut down", func() {
+			setup(2)
+			require.Nil(t, mediator.Shutdown(context.Background()))
+		})
+
+		s.When("the mediator delivers it", func() {
+			mediator.deliverDue()
+		})
+
+		s.Then("it should be removed from the scheduler", func() {
+			assert.Empty(t, scheduler.Pending())
+		})
+	}, t)
+}
+
+func TestScheduledBatchDelivery(t *testing.T) {
+	var (
+		mediator  *Mediator
+		scheduler *InMemoryCommandScheduler
+	)
+	ensure.That("a slow scheduled command does not hold back the rest of its batch", func(s *ensure.Scenario) {
+		s.Given("two due commands on different workers, the first of which waits for the second", func() {
+			scheduler = NewInMemoryCommandScheduler()
+			mediator = NewMediator(false,
+				WithScheduler(scheduler, time.Hour),
+				WithWorkers(2),
+				WithPartitionKey(func(cmd Command) string { return cmd.(expireReservation).Sku }))
+			require.NotEqual(t, mediator.partitionFor(expireReservation{"a"}), mediator.partitionFor(expireReservation{"b"}))
+
+			secondHandled := make(chan struct{})
+			_ = RegisterTypedCommandHandler(mediator, func(cmd expireReservation) error {
+				if cmd.Sku == "b" {
+					close(secondHandled)
+					return nil
+				}
+				select {
+				case <-secondHandled:
+					return nil
+				case <-time.After(5 * time.Second):
+					return errors.New("the second command was not dispatched")
+				}
+			})
+			for i, sku := range []string{"a", "b"} {
+				_ = scheduler.Schedule(context.Background(), ScheduledCommand{
+					Id:      sku,
+					Command: expireReservation{sku},
+					DueAt:   time.Now().Add(time.Duration(i-2) * time.Second),
+				})
+			}
+		})
+
+		s.When("the mediator delivers them", func() {
+			mediator.deliverDue()
+		})
+
+		s.Then("both should be handled and completed", func() {
+			assert.Empty(t, scheduler.Pending())
+		})
+	}, t)
+}
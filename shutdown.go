@@ -0,0 +1,91 @@
+package conqueress
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrMediatorShutdown is returned by Dispatch, DispatchSync, Publish and
+// PublishSync, and their context-aware counterparts, once Shutdown has stopped
+// the mediator accepting them.
+var ErrMediatorShutdown = errors.New("mediator is shut down")
+
+// Shutdown stops the mediator in two phases. It first stops delivering
+// scheduled commands, which stay in the scheduler, refuses new commands,
+// waits for the ones already queued to be handled, and stops the workers
+// that handle them. Events published while those commands drain are still
+// delivered. It then refuses new events and waits for the processors started
+// by Publish to return.
+//
+// Shutdown returns nil once all of that is done, or the context's error if ctx
+// is done first, in which case the remaining work carries on in the
+// background. Calling it again waits for the same work.
+func (m *Mediator) Shutdown(ctx context.Context) error {
+	m.shutdownOnce.Do(func() {
+		go m.shutdown()
+	})
+
+	select {
+	case <-m.shutdownComplete:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *Mediator) shutdown() {
+	close(m.stopScheduling)
+	<-m.schedulingStopped
+
+	m.lifecycle.Lock()
+	m.commandsClosed = true
+	m.lifecycle.Unlock()
+
+	// Nothing can start sending now, so once the senders already under way
+	// have finished, closing the partitions is safe and lets each worker drain
+	// its own and return.
+	m.dispatching.Wait()
+	for _, p := range m.partitions {
+		close(p)
+	}
+	<-m.commandsStopped
+
+	m.lifecycle.Lock()
+	m.eventsClosed = true
+	m.lifecycle.Unlock()
+
+	m.publishing.Wait()
+	close(m.shutdownComplete)
+}
+
+// beginDispatch reports whether a new command may be submitted, and if so
+// counts it as in flight until the matching endDispatch.
+func (m *Mediator) beginDispatch() bool {
+	m.lifecycle.Lock()
+	defer m.lifecycle.Unlock()
+	if m.commandsClosed {
+		return false
+	}
+	m.dispatching.Add(1)
+	return true
+}
+
+func (m *Mediator) endDispatch() {
+	m.dispatching.Done()
+}
+
+// beginPublish is the event counterpart of beginDispatch. It counts n
+// deliveries, one for each processor the event goes to.
+func (m *Mediator) beginPublish(n int) bool {
+	m.lifecycle.Lock()
+	defer m.lifecycle.Unlock()
+	if m.eventsClosed {
+		return false
+	}
+	m.publishing.Add(n)
+	return true
+}
+
+func (m *Mediator) endPublish() {
+	m.publishing.Done()
+}
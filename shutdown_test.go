@@ -0,0 +1,126 @@
+package conqueress
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdownDrainsQueuedCommands(t *testing.T) {
+	var (
+		mediator *Mediator
+		handled  atomic.Int32
+		err      error
+	)
+	ensure.That("shutdown handles every queued command before returning", func(s *ensure.Scenario) {
+		s.Given("a mediator with a slow command handler", func() {
+			mediator = NewMediator(false)
+			_ = RegisterCommandHandler[TestCmd](mediator, func(cmd Command) error {
+				time.Sleep(20 * time.Millisecond)
+				handled.Add(1)
+				return nil
+			})
+		})
+
+		s.And("several commands dispatched", func() {
+			for i := 0; i < 3; i++ {
+				_ = mediator.Dispatch(TestCmd{v2: i}, nil)
+			}
+		})
+
+		s.When("I shut the mediator down", func() {
+			err = mediator.Shutdown(context.Background())
+		})
+
+		s.Then("every command should have been handled", func() {
+			assert.Nil(t, err)
+			assert.Equal(t, int32(3), handled.Load())
+		})
+
+		s.And("the command goroutine should have stopped", func() {
+			select {
+			case <-mediator.commandsStopped:
+			default:
+				t.Error("processCommands is still running")
+			}
+		})
+
+		s.And("new commands and events should be refused", func() {
+			assert.ErrorIs(t, mediator.Dispatch(TestCmd{}, nil), ErrMediatorShutdown)
+			assert.ErrorIs(t, mediator.DispatchSync(TestCmd{}, nil), ErrMediatorShutdown)
+		})
+	}, t)
+}
+
+func TestShutdownWaitsForEventProcessors(t *testing.T) {
+	var (
+		mediator  *Mediator
+		processed atomic.Bool
+		err       error
+	)
+	ensure.That("shutdown waits for processors started by Publish", func(s *ensure.Scenario) {
+		s.Given("a mediator with a slow event processor", func() {
+			mediator = NewMediator(false)
+			_ = RegisterEventHandlers[TestEvent](mediator, func(evt Event) error {
+				time.Sleep(50 * time.Millisecond)
+				processed.Store(true)
+				return nil
+			})
+		})
+
+		s.And("an event published", func() {
+			_ = mediator.Publish(TestEvent{})
+		})
+
+		s.When("I shut the mediator down", func() {
+			err = mediator.Shutdown(context.Background())
+		})
+
+		s.Then("the processor should have finished", func() {
+			assert.Nil(t, err)
+			assert.True(t, processed.Load())
+		})
+
+		s.And("new events should be refused", func() {
+			assert.ErrorIs(t, mediator.Publish(TestEvent{}), ErrMediatorShutdown)
+			assert.ErrorIs(t, mediator.PublishSync(TestEvent{}), ErrMediatorShutdown)
+		})
+	}, t)
+}
+
+func TestShutdownGivesUpAtDeadline(t *testing.T) {
+	var (
+		mediator *Mediator
+		release  = make(chan struct{})
+		err      error
+	)
+	ensure.That("shutdown returns the context's error when work outlasts it", func(s *ensure.Scenario) {
+		s.Given("a mediator with a processor that blocks", func() {
+			mediator = NewMediator(false)
+			_ = RegisterEventHandlers[TestEvent](mediator, func(evt Event) error {
+				<-release
+				return nil
+			})
+			_ = mediator.Publish(TestEvent{})
+		})
+
+		s.When("I shut down with a short deadline", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			err = mediator.Shutdown(ctx)
+		})
+
+		s.Then("it should report the deadline", func() {
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+		})
+
+		s.And("a later call should finish once the work does", func() {
+			close(release)
+			assert.Nil(t, mediator.Shutdown(context.Background()))
+		})
+	}, t)
+}
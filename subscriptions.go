@@ -0,0 +1,65 @@
+package conqueress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// EventPredicate selects the events a wildcard subscription receives.
+type EventPredicate func(evt Event) bool
+
+// wildcardSubscription delivers every event its predicate accepts, whatever
+// the event's concrete type.
+type wildcardSubscription struct {
+	matches      EventPredicate
+	registration *processorRegistration
+}
+
+// SubscribeAll registers a processor for every event published, such as an
+// audit log or an outbox writer.
+//
+// Wildcard processors, registered with SubscribeAll, SubscribeMatching or
+// SubscribeInterface, run after the processors registered for the event's
+// exact type. Among themselves they run in the order they were registered.
+func (m *Mediator) SubscribeAll(processor ContextEventProcessor, opts ...ProcessorOption) (*Registration, error) {
+	return m.SubscribeMatching(func(Event) bool { return true }, processor, opts...)
+}
+
+// SubscribeMatching registers a processor for every event the predicate
+// accepts. The predicate runs on each publish, so keep it cheap.
+func (m *Mediator) SubscribeMatching(predicate EventPredicate, processor ContextEventProcessor, opts ...ProcessorOption) (*Registration, error) {
+	if predicate == nil {
+		return nil, errors.New("predicate is nil")
+	}
+	return m.subscribeWildcard(&wildcardSubscription{
+		matches:      predicate,
+		registration: newProcessorRegistration(processor, funcName(processor), opts),
+	})
+}
+
+// SubscribeInterface registers a processor for every event that implements
+// the interface I, such as every event an aggregate raises. The processor
+// receives the event as an I.
+func SubscribeInterface[I any](m *Mediator, processor func(ctx context.Context, evt I) error, opts ...ProcessorOption) (*Registration, error) {
+	iface := reflect.TypeOf((*I)(nil)).Elem()
+	if iface.Kind() != reflect.Interface {
+		return nil, fmt.Errorf("%v is not an interface type", iface)
+	}
+
+	typed := func(ctx context.Context, evt Event) error {
+		i, err := as[I](evt)
+		if err != nil {
+			return err
+		}
+		return processor(ctx, i)
+	}
+
+	return m.subscribeWildcard(&wildcardSubscription{
+		matches: func(evt Event) bool {
+			return reflect.TypeOf(evt).Implements(iface)
+		},
+		registration: newProcessorRegistration(typed, funcName(processor), opts),
+	})
+}
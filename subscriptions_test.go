@@ -0,0 +1,81 @@
+package conqueress
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+)
+
+type skuEvent interface {
+	Sku() string
+}
+
+type stockAdjusted struct {
+	TestEvent
+	sku string
+}
+
+func (e stockAdjusted) Sku() string {
+	return e.sku
+}
+
+type unrelatedEvent struct {
+	TestEvent
+}
+
+func TestWildcardSubscriptions(t *testing.T) {
+	var (
+		mediator *Mediator
+		calls    []string
+		skus     []string
+	)
+	record := func(name string) ContextEventProcessor {
+		return func(ctx context.Context, evt Event) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+	ensure.That("wildcard subscriptions receive events after exact-type processors", func(s *ensure.Scenario) {
+		s.Given("a mediator with wildcard subscriptions registered first", func() {
+			mediator = NewMediator(false)
+			_, _ = mediator.SubscribeAll(record("all"), WithProcessorName("all"))
+			_, _ = SubscribeInterface[skuEvent](mediator, func(ctx context.Context, evt skuEvent) error {
+				calls = append(calls, "interface")
+				skus = append(skus, evt.Sku())
+				return nil
+			})
+			_, _ = mediator.SubscribeMatching(func(evt Event) bool {
+				_, ok := evt.(unrelatedEvent)
+				return ok
+			}, record("predicate"), WithProcessorName("predicate"))
+		})
+
+		s.And("an exact-type processor registered last", func() {
+			_ = RegisterEventProcessor[stockAdjusted](mediator, record("exact"))
+		})
+
+		s.When("I publish an event that implements the interface", func() {
+			assert.Nil(t, mediator.PublishSync(stockAdjusted{sku: "widget"}))
+		})
+
+		s.Then("the exact processor should run first, then the matching wildcards in order", func() {
+			assert.Equal(t, []string{"exact", "all", "interface"}, calls)
+			assert.Equal(t, []string{"widget"}, skus)
+		})
+
+		s.And("an event with no exact processor should still reach the wildcards", func() {
+			calls = nil
+			assert.Nil(t, mediator.PublishSync(unrelatedEvent{}))
+			assert.Equal(t, []string{"all", "predicate"}, calls)
+		})
+
+		s.And("only interface types can be subscribed to by interface", func() {
+			_, err := SubscribeInterface[stockAdjusted](mediator, func(ctx context.Context, evt stockAdjusted) error {
+				return nil
+			})
+			assert.NotNil(t, err)
+		})
+	}, t)
+}
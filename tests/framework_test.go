@@ -52,7 +52,7 @@ func TestApplication(t *testing.T) {
 
 		commands := sample_domain.NewInventoryCommandHandler(repo)
 		handler := newTestPublisher()
-		cqrs.RegisterCommandHandler[sample_domain.CreateInventoryItem](m, commands.HandleCreateInventoryItem)
+		cqrs.RegisterTypedCommandHandler(m, commands.HandleCreateInventoryItem)
 		cqrs.RegisterEventHandlers[sample_domain.InventoryItemCreated](m, handler.Handle)
 
 		actualId := guid.New()
@@ -72,8 +72,8 @@ func TestApplication(t *testing.T) {
 
 		commands := sample_domain.NewInventoryCommandHandler(repo)
 		handler := newTestPublisher()
-		m.RegisterCommandHandler(reflect.TypeOf(sample_domain.CreateInventoryItem{}), commands.HandleCreateInventoryItem)
-		m.RegisterCommandHandler(reflect.TypeOf(sample_domain.RenameInventoryItem{}), commands.HandleRenameInventoryItem)
+		cqrs.RegisterTypedCommandHandler(m, commands.HandleCreateInventoryItem)
+		cqrs.RegisterTypedCommandHandler(m, commands.HandleRenameInventoryItem)
 		m.RegisterEventHandler(reflect.TypeOf(sample_domain.InventoryItemCreated{}), handler.Handle)
 		m.RegisterEventHandler(reflect.TypeOf(sample_domain.InventoryItemRenamed{}), handler.Handle)
 
@@ -0,0 +1,108 @@
+package conqueress
+
+import (
+	"context"
+	"reflect"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/iamkoch/conqueress"
+
+// Span attributes recorded by the mediator.
+const (
+	CommandTypeKey = attribute.Key("conqueress.command.type")
+	EventTypeKey   = attribute.Key("conqueress.event.type")
+	ProcessorKey   = attribute.Key("conqueress.processor")
+)
+
+// traceContext is the format trace context is stored in on events. It is
+// fixed, rather than the global propagator, so events recorded by one
+// service can be linked by another whatever either has configured.
+var traceContext = propagation.TraceContext{}
+
+// WithTracerProvider sets where the mediator's spans go. The default is the
+// global provider from otel.GetTracerProvider, which discards spans until
+// one is registered with otel.SetTracerProvider.
+//
+// The mediator records a span for each dispatch, with a child for the
+// handler, one for each publish, and one for each delivery of an event to a
+// processor. Processors of an event that carries trace context, because it
+// was saved while a command was handled, link back to that command's trace.
+func WithTracerProvider(tp trace.TracerProvider) MediatorOption {
+	return func(m *Mediator) {
+		m.tracer = tp.Tracer(instrumentationName)
+	}
+}
+
+func defaultTracer() trace.Tracer {
+	return otel.GetTracerProvider().Tracer(instrumentationName)
+}
+
+// InjectTraceContext records the span in ctx in evt's headers, if evt carries
+// headers and ctx has a span. Repositories call it for every event they save.
+func InjectTraceContext(ctx context.Context, evt Event) {
+	if hc, ok := evt.(HeaderCarrier); ok && trace.SpanContextFromContext(ctx).IsValid() {
+		traceContext.Inject(ctx, eventHeaders{hc})
+	}
+}
+
+// TraceContextFrom returns the span context recorded in evt's headers, which
+// is not valid if there is none.
+func TraceContextFrom(evt Event) trace.SpanContext {
+	hc, ok := evt.(HeaderCarrier)
+	if !ok {
+		return trace.SpanContext{}
+	}
+	return trace.SpanContextFromContext(traceContext.Extract(context.Background(), eventHeaders{hc}))
+}
+
+// eventHeaders adapts a HeaderCarrier to propagation.TextMapCarrier.
+type eventHeaders struct {
+	HeaderCarrier
+}
+
+func (h eventHeaders) Get(key string) string {
+	return h.Header(key)
+}
+
+func (h eventHeaders) Set(key, value string) {
+	h.SetHeader(key, value)
+}
+
+func (h eventHeaders) Keys() []string {
+	return h.HeaderKeys()
+}
+
+// startEventSpan starts a span for publishing or processing evt. When the
+// event carries trace context from another trace, the span links to it, or
+// continues it if ctx has no span of its own.
+func (m *Mediator) startEventSpan(ctx context.Context, name string, evt Event, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	eventType := reflect.TypeOf(evt).String()
+	opts = append(opts, trace.WithAttributes(EventTypeKey.String(eventType)))
+
+	if origin := TraceContextFrom(evt); origin.IsValid() {
+		parent := trace.SpanContextFromContext(ctx)
+		switch {
+		case !parent.IsValid():
+			ctx = trace.ContextWithRemoteSpanContext(ctx, origin)
+		case parent.TraceID() != origin.TraceID():
+			opts = append(opts, trace.WithLinks(trace.Link{SpanContext: origin}))
+		}
+	}
+
+	return m.tracer.Start(ctx, name+" "+eventType, opts...)
+}
+
+// endSpan records err on span, if there is one, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
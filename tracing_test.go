@@ -0,0 +1,90 @@
+package conqueress
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type itemShipped struct {
+	*BaseEvent
+}
+
+func spanNamed(spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	for _, s := range spans {
+		if s.Name() == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	var (
+		recorder *tracetest.SpanRecorder
+		provider *sdktrace.TracerProvider
+		mediator *Mediator
+		shipped  itemShipped
+	)
+	setup := func() {
+		recorder = tracetest.NewSpanRecorder()
+		provider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		mediator = NewMediator(false, WithTracerProvider(provider))
+	}
+
+	ensure.That("dispatching a command records a dispatch span with the handler inside it", func(s *ensure.Scenario) {
+		s.Given("a traced mediator with a handler", func() {
+			setup()
+			_ = RegisterTypedCommandHandler(mediator, func(cmd createWidget) error { return nil })
+		})
+
+		s.When("I dispatch a command", func() {
+			require.Nil(t, mediator.DispatchSync(createWidget{"widget"}, nil))
+		})
+
+		s.Then("the handler span should be a child of the dispatch span", func() {
+			spans := recorder.Ended()
+			dispatch := spanNamed(spans, "dispatch conqueress.createWidget")
+			handle := spanNamed(spans, "handle conqueress.createWidget")
+			require.NotNil(t, dispatch)
+			require.NotNil(t, handle)
+			assert.Equal(t, dispatch.SpanContext().SpanID(), handle.Parent().SpanID())
+			assert.Equal(t, dispatch.SpanContext().TraceID(), handle.SpanContext().TraceID())
+		})
+	}, t)
+
+	ensure.That("a processor of an event saved under a command continues the command's trace", func(s *ensure.Scenario) {
+		processed := make(chan struct{})
+		s.Given("an event raised while a command was traced", func() {
+			setup()
+			_, _ = Subscribe(mediator, func(ctx context.Context, evt itemShipped) error {
+				close(processed)
+				return nil
+			})
+			ctx, span := provider.Tracer("test").Start(context.Background(), "command")
+			shipped = NewEvent[itemShipped]()
+			InjectTraceContext(ctx, shipped)
+			span.End()
+		})
+
+		s.When("the event is published without a trace", func() {
+			require.Nil(t, mediator.Publish(shipped))
+			<-processed
+			require.Nil(t, mediator.Shutdown(context.Background()))
+		})
+
+		s.Then("the processor span should belong to the command's trace", func() {
+			spans := recorder.Ended()
+			command := spanNamed(spans, "command")
+			process := spanNamed(spans, "process conqueress.itemShipped")
+			require.NotNil(t, process)
+			assert.Equal(t, command.SpanContext().TraceID(), process.SpanContext().TraceID())
+			assert.True(t, TraceContextFrom(shipped).IsValid())
+		})
+	}, t)
+}
@@ -0,0 +1,85 @@
+package conqueress
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// HandlerTypeError is returned by a handler registered through one of the
+// typed registration functions when it receives a message that is not of the
+// type it was registered for.
+type HandlerTypeError struct {
+	Expected reflect.Type
+	Received reflect.Type
+}
+
+func (e *HandlerTypeError) Error() string {
+	return fmt.Sprintf("handler for %v received %v", e.Expected, e.Received)
+}
+
+// as converts msg to T, or returns a HandlerTypeError describing why it
+// cannot.
+func as[T any](msg any) (T, error) {
+	t, ok := msg.(T)
+	if !ok {
+		return t, &HandlerTypeError{
+			Expected: reflect.TypeOf((*T)(nil)).Elem(),
+			Received: reflect.TypeOf(msg),
+		}
+	}
+	return t, nil
+}
+
+// RegisterTypedCommandHandler registers a handler that takes the command as a
+// T, so it does not need to assert the command's type itself.
+func RegisterTypedCommandHandler[T Command](m *Mediator, handler func(cmd T) error) error {
+	return RegisterTypedContextCommandHandler[T](m, func(_ context.Context, cmd T) error {
+		return handler(cmd)
+	})
+}
+
+// RegisterTypedContextCommandHandler is the context-aware counterpart of
+// RegisterTypedCommandHandler.
+func RegisterTypedContextCommandHandler[T Command](m *Mediator, handler func(ctx context.Context, cmd T) error) error {
+	return RegisterContextCommandHandler[T](m, func(ctx context.Context, cmd Command) error {
+		t, err := as[T](cmd)
+		if err != nil {
+			return err
+		}
+		return handler(ctx, t)
+	})
+}
+
+// RegisterTypedEventHandlers registers processors that take the event as a
+// T, so they do not need to assert the event's type themselves.
+func RegisterTypedEventHandlers[T Event](m *Mediator, handlers ...func(evt T) error) error {
+	registrations := make([]*processorRegistration, 0, len(handlers))
+	for _, h := range handlers {
+		processor := typedProcessor(func(_ context.Context, evt T) error {
+			return h(evt)
+		})
+		registrations = append(registrations, newProcessorRegistration(processor, funcName(h), nil))
+	}
+	return registerEventHandlers[T](m, registrations)
+}
+
+// RegisterTypedContextEventHandlers is the context-aware counterpart of
+// RegisterTypedEventHandlers.
+func RegisterTypedContextEventHandlers[T Event](m *Mediator, handlers ...func(ctx context.Context, evt T) error) error {
+	registrations := make([]*processorRegistration, 0, len(handlers))
+	for _, h := range handlers {
+		registrations = append(registrations, newProcessorRegistration(typedProcessor(h), funcName(h), nil))
+	}
+	return registerEventHandlers[T](m, registrations)
+}
+
+func typedProcessor[T Event](h func(ctx context.Context, evt T) error) ContextEventProcessor {
+	return func(ctx context.Context, evt Event) error {
+		t, err := as[T](evt)
+		if err != nil {
+			return err
+		}
+		return h(ctx, t)
+	}
+}
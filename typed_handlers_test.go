@@ -0,0 +1,51 @@
+package conqueress
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypedHandlers(t *testing.T) {
+	var (
+		mediator *Mediator
+		received []TestCmd
+		events   []TestEvent
+	)
+	ensure.That("typed handlers receive their message without asserting its type", func(s *ensure.Scenario) {
+		s.Given("a mediator with typed command and event handlers", func() {
+			mediator = NewMediator(false)
+			_ = RegisterTypedCommandHandler(mediator, func(cmd TestCmd) error {
+				received = append(received, cmd)
+				return nil
+			})
+			_ = RegisterTypedEventHandlers(mediator, func(evt TestEvent) error {
+				events = append(events, evt)
+				return nil
+			})
+		})
+
+		s.When("I dispatch a command and publish an event", func() {
+			assert.Nil(t, mediator.DispatchSync(TestCmd{v1: "typed"}, nil))
+			assert.Nil(t, mediator.PublishSync(TestEvent{}))
+		})
+
+		s.Then("the handlers should have received them", func() {
+			assert.Equal(t, []TestCmd{{v1: "typed"}}, received)
+			assert.Len(t, events, 1)
+		})
+
+		s.And("a mismatched message should be reported rather than panic", func() {
+			handler, _ := mediator.snapshot().commandHandler(reflect.TypeOf(TestCmd{}))
+			_, err := handler(context.Background(), "not a TestCmd")
+
+			var typeErr *HandlerTypeError
+			assert.ErrorAs(t, err, &typeErr)
+			assert.Equal(t, reflect.TypeOf(TestCmd{}), typeErr.Expected)
+			assert.Equal(t, reflect.TypeOf(""), typeErr.Received)
+		})
+	}, t)
+}
@@ -0,0 +1,234 @@
+package conqueress
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Validatable is implemented by commands that check themselves. Validate
+// returns nil when the command is valid. It may return a *ValidationError,
+// one or more FieldErrors (joined with errors.Join), or any other error,
+// which is reported against the command as a whole.
+type Validatable interface {
+	Validate() error
+}
+
+// CommandValidator checks a command that was registered for validation with
+// RegisterValidator. It reports failures the same way Validatable.Validate
+// does.
+type CommandValidator func(cmd Command) error
+
+// FieldError is a single validation failure. Field is empty when the failure
+// is not about one field.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + " " + e.Message
+}
+
+// ValidationError is returned by Dispatch, DispatchSync and their variants
+// when a command fails validation. It lists every failure, not just the
+// first, and the command is neither queued nor handled.
+type ValidationError struct {
+	Command reflect.Type
+	Fields  []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		messages = append(messages, f.Error())
+	}
+	return fmt.Sprintf("invalid %v: %s", e.Command, strings.Join(messages, "; "))
+}
+
+// RegisterValidator adds a validator for commands of type T. Validators run
+// after the command's struct tag rules and its own Validate method, in the
+// order they were registered.
+func RegisterValidator[T Command](m *Mediator, validator func(cmd T) error) error {
+	var t T
+	return m.RegisterValidator(reflect.TypeOf(t), func(cmd Command) error {
+		typed, err := as[T](cmd)
+		if err != nil {
+			return err
+		}
+		return validator(typed)
+	})
+}
+
+// RegisterValidator adds a validator for commands of type cmdType.
+func (m *Mediator) RegisterValidator(cmdType reflect.Type, validator CommandValidator) error {
+	return m.updateRegistry(func(r *registry) error {
+		if r.sealed {
+			return ErrRegistrySealed
+		}
+		validators := r.validators[cmdType]
+		r.validators[cmdType] = append(validators[:len(validators):len(validators)], validator)
+		return nil
+	})
+}
+
+// validate checks cmd against the rules in its `validate` struct tags, its
+// Validate method and the validators registered for its type, and returns a
+// *ValidationError listing every failure, or nil if there were none.
+//
+// The tag holds a comma-separated list of rules:
+//
+//	required  the field must not be its zero value
+//	min=N     numbers must be at least N; strings, slices and maps must have
+//	          at least N elements
+//	max=N     the same, for at most N
+//	len=N     strings, slices and maps must have exactly N elements
+//
+// Rules other than required are skipped for nil pointers.
+func (r *registry) validate(cmd Command) error {
+	verr := &ValidationError{Command: reflect.TypeOf(cmd)}
+
+	if err := checkTags(cmd, verr); err != nil {
+		return err
+	}
+	if v, ok := cmd.(Validatable); ok {
+		verr.add(v.Validate())
+	}
+	for _, validator := range r.validators[reflect.TypeOf(cmd)] {
+		verr.add(validator(cmd))
+	}
+
+	if len(verr.Fields) == 0 {
+		return nil
+	}
+	return verr
+}
+
+func (e *ValidationError) add(err error) {
+	if err == nil {
+		return
+	}
+
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, inner := range joined.Unwrap() {
+			e.add(inner)
+		}
+		return
+	}
+
+	var verr *ValidationError
+	var ferr FieldError
+	switch {
+	case errors.As(err, &verr):
+		e.Fields = append(e.Fields, verr.Fields...)
+	case errors.As(err, &ferr):
+		e.Fields = append(e.Fields, ferr)
+	default:
+		e.Fields = append(e.Fields, FieldError{Message: err.Error()})
+	}
+}
+
+func checkTags(cmd Command, verr *ValidationError) error {
+	v := reflect.ValueOf(cmd)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag, ok := t.Field(i).Tag.Lookup("validate")
+		if !ok || tag == "" || tag == "-" {
+			continue
+		}
+		for _, rule := range strings.Split(tag, ",") {
+			message, err := checkRule(v.Field(i), strings.TrimSpace(rule))
+			if err != nil {
+				return fmt.Errorf("%v.%s: %w", t, t.Field(i).Name, err)
+			}
+			if message != "" {
+				verr.Fields = append(verr.Fields, FieldError{t.Field(i).Name, message})
+			}
+		}
+	}
+	return nil
+}
+
+// checkRule returns a message describing how field breaks rule, or an empty
+// message if it does not. It returns an error if the rule is malformed.
+func checkRule(field reflect.Value, rule string) (string, error) {
+	name, arg, hasArg := strings.Cut(rule, "=")
+	if name == "required" {
+		if field.IsZero() {
+			return "is required", nil
+		}
+		return "", nil
+	}
+
+	if !hasArg {
+		return "", fmt.Errorf("unknown validation rule %q", rule)
+	}
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return "", fmt.Errorf("validation rule %q: %w", rule, err)
+	}
+
+	for field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return "", nil
+		}
+		field = field.Elem()
+	}
+
+	var value float64
+	isLength := false
+	switch field.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		value, isLength = float64(field.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value = float64(field.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value = float64(field.Uint())
+	case reflect.Float32, reflect.Float64:
+		value = field.Float()
+	default:
+		return "", fmt.Errorf("validation rule %q does not apply to %v", rule, field.Type())
+	}
+
+	switch name {
+	case "min":
+		if value < limit {
+			if isLength {
+				return fmt.Sprintf("must have a length of at least %s", arg), nil
+			}
+			return fmt.Sprintf("must be at least %s", arg), nil
+		}
+	case "max":
+		if value > limit {
+			if isLength {
+				return fmt.Sprintf("must have a length of at most %s", arg), nil
+			}
+			return fmt.Sprintf("must be at most %s", arg), nil
+		}
+	case "len":
+		if !isLength {
+			return "", fmt.Errorf("validation rule %q does not apply to %v", rule, field.Type())
+		}
+		if value != limit {
+			return fmt.Sprintf("must have a length of %s", arg), nil
+		}
+	default:
+		return "", fmt.Errorf("unknown validation rule %q", rule)
+	}
+	return "", nil
+}
@@ -0,0 +1,101 @@
+package conqueress
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/iamkoch/ensure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type reserveStock struct {
+	Sku      string  `validate:"required,len=6"`
+	Quantity int     `validate:"min=1,max=10"`
+	Note     *string `validate:"max=3"`
+}
+
+func (r reserveStock) Validate() error {
+	if r.Sku == "banned" {
+		return FieldError{"Sku", "is not for sale"}
+	}
+	return nil
+}
+
+func TestValidation(t *testing.T) {
+	var (
+		mediator *Mediator
+		handled  int
+		err      error
+	)
+	ensure.That("every failing rule is reported and the command is not handled", func(s *ensure.Scenario) {
+		s.Given("a mediator with a handler and a registered validator", func() {
+			mediator = NewMediator(false)
+			_ = RegisterTypedCommandHandler(mediator, func(cmd reserveStock) error {
+				handled++
+				return nil
+			})
+			require.Nil(t, RegisterValidator(mediator, func(cmd reserveStock) error {
+				return errors.Join(FieldError{"Quantity", "must be even"}, errors.New("stock is frozen"))
+			}))
+		})
+
+		s.When("I dispatch an invalid command", func() {
+			err = mediator.DispatchSync(reserveStock{Sku: "banned", Quantity: 11}, nil)
+		})
+
+		s.Then("a validation error should list every failure", func() {
+			var verr *ValidationError
+			require.True(t, errors.As(err, &verr))
+			assert.Equal(t, []FieldError{
+				{"Quantity", "must be at most 10"},
+				{"Sku", "is not for sale"},
+				{"Quantity", "must be even"},
+				{"", "stock is frozen"},
+			}, verr.Fields)
+			assert.Equal(t, 0, handled)
+		})
+	}, t)
+
+	ensure.That("a valid command is queued and handled", func(s *ensure.Scenario) {
+		var resp chan CommandProcessingError
+		s.Given("a mediator with a handler", func() {
+			mediator = NewMediator(false)
+			handled = 0
+			_ = RegisterTypedCommandHandler(mediator, func(cmd reserveStock) error {
+				handled++
+				return nil
+			})
+			resp = make(chan CommandProcessingError, 1)
+		})
+
+		s.When("I dispatch a valid command", func() {
+			note := "ok"
+			err = mediator.DispatchContext(context.Background(), reserveStock{Sku: "widget", Quantity: 2, Note: &note}, resp)
+		})
+
+		s.Then("it should be handled", func() {
+			require.Nil(t, err)
+			assert.Nil(t, <-resp)
+			assert.Equal(t, 1, handled)
+		})
+	}, t)
+
+	ensure.That("a missing required field is reported before queueing", func(s *ensure.Scenario) {
+		s.Given("a mediator with a handler", func() {
+			mediator = NewMediator(false)
+			_ = RegisterTypedCommandHandler(mediator, func(cmd reserveStock) error { return nil })
+		})
+
+		s.When("I dispatch a command without a SKU", func() {
+			err = mediator.Dispatch(reserveStock{Quantity: 1}, nil)
+		})
+
+		s.Then("it should be rejected", func() {
+			var verr *ValidationError
+			require.True(t, errors.As(err, &verr))
+			assert.Contains(t, verr.Fields, FieldError{"Sku", "is required"})
+		})
+	}, t)
+}